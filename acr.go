@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	defaultACRHeader   = "Authorization"
+	acrActionPush      = "push"
+	acrActionPing      = "ping"
+	acrActionChartPush = "chart_push"
+)
+
+// acrConfig - Azure Container Registry webhook, the "Custom headers" of the webhook must have Header: Value
+type acrConfig struct {
+	Header string // default Authorization
+	Value  string
+}
+
+// ACRPayload - payload of ACR webhook
+type ACRPayload struct {
+	ID     string
+	Action string
+	Target struct {
+		MediaType  string
+		Digest     string
+		Repository string
+		Tag        string
+	}
+	Request struct {
+		Host string
+	}
+}
+
+func authorizeACR(c *mainConfig, r *http.Request, body []byte) error {
+	if c.ACR.Value == "" {
+		return errors.New("ACR.Value is not configured")
+	}
+	header := c.ACR.Header
+	if header == "" {
+		header = defaultACRHeader
+	}
+	return headerTokenMatches(r, header, c.ACR.Value)
+}
+
+func (h *SwarmServiceHandler) acrPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := ACRPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookACR, payload)
+
+	var params HookParamsFromPayload
+	if payload.Target.Repository != "" {
+		params.registryImage = payload.Request.Host + "/" + payload.Target.Repository
+		if payload.Target.Tag != "" {
+			params.registryImage += ":" + payload.Target.Tag
+		}
+	}
+	switch payload.Action {
+	case acrActionPush:
+	case acrActionPing:
+		result.ignore(payload.ID, "", "ping event")
+		return result, nil
+	case acrActionChartPush:
+		result.ignore(payload.ID, params.registryImage, "helm charts are not deployable")
+		return result, nil
+	case "":
+		return result, errors.New("payload without action")
+	default:
+		result.ignore(payload.ID, params.registryImage, "action "+payload.Action+" is ignored")
+		return result, nil
+	}
+	if payload.Target.Repository == "" || payload.Request.Host == "" {
+		return result, errors.New("payload without target repository or request host")
+	}
+	if payload.Target.Tag == "" {
+		result.ignore(payload.ID, params.registryImage, "push without tag")
+		return result, nil
+	}
+	params.digest = payload.Target.Digest
+	params.serviceNames = h.config.servicesFor(params.registryImage)
+	result.add(params)
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const payloadACRPush = `{
+  "id": "cb8c3971-9adc-488b-bdd8-43cbb4974ff5",
+  "timestamp": "2017-11-17T16:52:01.343145347Z",
+  "action": "push",
+  "target": {
+    "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+    "size": 524,
+    "digest": "sha256:80f0d5c8786bb9e621a45ece0db56d11cdc624ad20da9fe62e9d25490f331d7d",
+    "length": 524,
+    "repository": "app",
+    "tag": "v1"
+  },
+  "request": {
+    "id": "3cbb6949-7549-4fa1-86cd-a6d5451dffc7",
+    "host": "vorona.azurecr.io",
+    "method": "PUT",
+    "useragent": "docker/17.09.0-ce go/go1.8.3 git-commit/afdb6d4 kernel/4.10.0-27-generic os/linux arch/amd64"
+  }
+}`
+
+func TestACRWebhook(t *testing.T) {
+	config := testConfig
+	config.ACR = acrConfig{Header: "X-Ddw-Token", Value: "aeT4ooXei2ohgh3e"}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	token := map[string]string{"X-Ddw-Token": "aeT4ooXei2ohgh3e"}
+	payloadPing := `{"id": "1b4f9d6a", "action": "ping", "timestamp": "2017-11-17T16:50:00Z"}`
+	payloadChart := `{"id": "6356e9e0", "action": "chart_push", "target": {"mediaType": "application/vnd.acr.helm.chart", "repository": "repo", "name": "helloworld", "version": "0.1.0", "tag": "helloworld-0.1.0.tgz"}, "request": {"host": "vorona.azurecr.io"}}`
+
+	cases := []Case{
+		{ // case 0: ?key= isn't accepted
+			Path:    APIEndpointWebHookACR,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadACRPush,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookACR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadPing,
+			Headers: token,
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"event": "1b4f9d6a", "reason": "ping event"}}},
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookACR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadChart,
+			Headers: token,
+			Result: CR{"error": "nothing to deploy", "ignored": []CR{{
+				"event": "6356e9e0", "image": "vorona.azurecr.io/repo:helloworld-0.1.0.tgz", "reason": "helm charts are not deployable",
+			}}},
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookACR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadACRPush,
+			Headers: token,
+			Result:  unmappedResult("vorona.azurecr.io/app:v1"),
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookACR,
+			Method:  http.MethodPost,
+			Status:  http.StatusBadRequest,
+			Payload: `{}`,
+			Headers: token,
+			Result:  CR{"error": "can't decode payload: payload without action"},
+		},
+	}
+	runTests(t, ts, cases, config)
+}
+
+func TestACRPayloadDigest(t *testing.T) {
+	config := testConfig
+	config.Services = map[string]serviceList{"vorona.azurecr.io/app:v1": {"app"}}
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(payloadACRPush), APIEndpointWebHookACR, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []HookParamsFromPayload{{
+		"vorona.azurecr.io/app:v1",
+		"sha256:80f0d5c8786bb9e621a45ece0db56d11cdc624ad20da9fe62e9d25490f331d7d",
+		[]string{"app"},
+	}}
+	if !reflect.DeepEqual(payload.targets, expected) {
+		t.Errorf("expected targets %+v, got %+v", expected, payload.targets)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	artifactoryAuthHeader  = "X-JFrog-Event-Auth"
+	artifactoryDomain      = "docker"
+	artifactoryEventPushed = "pushed"
+)
+
+// artifactoryConfig - JFrog Artifactory webhook, Secret is the secret of the webhook.
+// Artifactory sends the secret itself in X-JFrog-Event-Auth, or HMAC-SHA256 of the payload
+// when "Use secret for payload signing" is on, then SignPayload must be set too.
+type artifactoryConfig struct {
+	Secret      string
+	SignPayload bool
+	Registry    string // image prefix, e.g. docker-local.jfrog.example.com, default <jpd_origin host>/<repo_key>
+}
+
+// ArtifactoryPayload - payload of Artifactory docker webhook
+type ArtifactoryPayload struct {
+	Domain    string
+	EventType string `json:"event_type"`
+	JpdOrigin string `json:"jpd_origin"`
+	Data      struct {
+		RepoKey   string `json:"repo_key"`
+		ImageName string `json:"image_name"`
+		Tag       string
+		Sha256    string
+	}
+}
+
+func authorizeArtifactory(c *mainConfig, r *http.Request, body []byte) error {
+	if c.Artifactory.Secret == "" {
+		return errors.New("Artifactory.Secret is not configured")
+	}
+	if c.Artifactory.SignPayload {
+		signature := signatureConfig{Secret: c.Artifactory.Secret, Header: artifactoryAuthHeader}
+		return signature.verify(r.Header, body, time.Now())
+	}
+	return headerTokenMatches(r, artifactoryAuthHeader, c.Artifactory.Secret)
+}
+
+func (h *SwarmServiceHandler) artifactoryPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := ArtifactoryPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookArtifactory, payload)
+	if payload.Domain != artifactoryDomain || payload.EventType != artifactoryEventPushed {
+		result.ignore("", "", "event "+payload.Domain+"/"+payload.EventType+" is ignored")
+		return result, nil
+	}
+	if payload.Data.ImageName == "" {
+		return result, errors.New("payload without image_name")
+	}
+
+	var params HookParamsFromPayload
+	registry := h.config.Artifactory.Registry
+	if registry == "" {
+		origin, err := url.Parse(payload.JpdOrigin)
+		if err != nil || origin.Host == "" {
+			return result, errors.New("can't get registry host from jpd_origin, set Artifactory.Registry")
+		}
+		registry = origin.Host + "/" + payload.Data.RepoKey
+	}
+	params.registryImage = registry + "/" + payload.Data.ImageName
+	if payload.Data.Tag == "" {
+		result.ignore("", params.registryImage, "push without tag")
+		return result, nil
+	}
+	params.registryImage += ":" + payload.Data.Tag
+	if payload.Data.Sha256 != "" {
+		params.digest = "sha256:" + payload.Data.Sha256
+	}
+	params.serviceNames = h.config.servicesFor(params.registryImage)
+	result.add(params)
+	return result, nil
+}
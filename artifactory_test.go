@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testArtifactorySecret  = "Ahm5eiquoh4ohTh6"
+	payloadArtifactoryPush = `{
+  "domain": "docker",
+  "event_type": "pushed",
+  "data": {
+    "repo_key": "docker-local",
+    "event_type": "pushed",
+    "path": "vorona/app/1.4.0/manifest.json",
+    "name": "manifest.json",
+    "sha256": "35c4a2c15539c6c1e4e5fa4e554dac323ad0107d8eb5c582d6ff386b383b7dce",
+    "size": 1206,
+    "image_name": "vorona/app",
+    "tag": "1.4.0"
+  },
+  "subscription_key": "ddw",
+  "jpd_origin": "https://vorona.jfrog.io",
+  "source": "jfrt@01ggyj2bz6jch01h6mxy2c1stn"
+}`
+)
+
+func TestArtifactoryWebhook(t *testing.T) {
+	config := testConfig
+	config.Artifactory = artifactoryConfig{Secret: testArtifactorySecret}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	secret := map[string]string{artifactoryAuthHeader: testArtifactorySecret}
+
+	cases := []Case{
+		{ // case 0: ?key= isn't accepted
+			Path:    APIEndpointWebHookArtifactory,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadArtifactoryPush,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookArtifactory,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadArtifactoryPush,
+			Headers: secret,
+			Result:  unmappedResult("vorona.jfrog.io/docker-local/vorona/app:1.4.0"),
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookArtifactory,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: `{"domain": "docker", "event_type": "deleted", "data": {"image_name": "vorona/app", "tag": "1.4.0"}}`,
+			Headers: secret,
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"reason": "event docker/deleted is ignored"}}},
+		},
+	}
+	runTests(t, ts, cases, config)
+
+	// payload signing mode: the header carries HMAC-SHA256 of the payload instead of the secret
+	config.Artifactory.SignPayload = true
+	ts = httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	signed := cases[1]
+	signed.Headers = map[string]string{artifactoryAuthHeader: testSignature(testArtifactorySecret, payloadArtifactoryPush)}
+	plain := cases[1]
+	plain.Status = http.StatusForbidden
+	plain.Result = CR{"error": "unauthorized"}
+	runTests(t, ts, []Case{signed, plain}, config)
+}
+
+func TestArtifactoryPayloadRegistry(t *testing.T) {
+	config := testConfig
+	config.Artifactory.Registry = "docker-local.jfrog.example.com"
+	config.Services = map[string]serviceList{"docker-local.jfrog.example.com/vorona/app:1.4.0": {"app"}}
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(payloadArtifactoryPush), APIEndpointWebHookArtifactory, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []HookParamsFromPayload{{
+		"docker-local.jfrog.example.com/vorona/app:1.4.0",
+		"sha256:35c4a2c15539c6c1e4e5fa4e554dac323ad0107d8eb5c582d6ff386b383b7dce",
+		[]string{"app"},
+	}}
+	if !reflect.DeepEqual(payload.targets, expected) {
+		t.Errorf("expected targets %+v, got %+v", expected, payload.targets)
+	}
+}
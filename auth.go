@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSignatureHeader    = "X-Signature"
+	defaultSignatureTolerance = 5 * time.Minute
+	signaturePrefix           = "sha256="
+)
+
+// signatureConfig - HMAC-SHA256 request signing, it replaces ?key= auth when Secret is set.
+// Signature is hex(hmac_sha256(Secret, body)), with "sha256=" prefix or without it.
+// When TimestampHeader is set, the header must carry unix time in seconds
+// and the signed content becomes "<timestamp>.<body>", so the request can't be replayed
+// out of Tolerance window.
+type signatureConfig struct {
+	Secret          string
+	Header          string   // default X-Signature
+	TimestampHeader string   // optional, e.g. X-Signature-Timestamp
+	Tolerance       duration // default 5m
+}
+
+func (c *signatureConfig) enabled() bool {
+	return c.Secret != ""
+}
+
+// verify - checks signature of body, now is a parameter for tests
+func (c *signatureConfig) verify(header http.Header, body []byte, now time.Time) error {
+	headerName := c.Header
+	if headerName == "" {
+		headerName = defaultSignatureHeader
+	}
+	signature := strings.TrimPrefix(header.Get(headerName), signaturePrefix)
+	if signature == "" {
+		return fmt.Errorf("missing %s header", headerName)
+	}
+	received, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("bad %s header: %s", headerName, err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	if c.TimestampHeader != "" {
+		timestamp := header.Get(c.TimestampHeader)
+		if err := c.checkTimestamp(timestamp, now); err != nil {
+			return err
+		}
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+	if !hmac.Equal(received, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func (c *signatureConfig) checkTimestamp(timestamp string, now time.Time) error {
+	if timestamp == "" {
+		return fmt.Errorf("missing %s header", c.TimestampHeader)
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad %s header: %s", c.TimestampHeader, err)
+	}
+	tolerance := c.Tolerance.Duration
+	if tolerance <= 0 {
+		tolerance = defaultSignatureTolerance
+	}
+	if diff := now.Sub(time.Unix(sec, 0)); diff > tolerance || diff < -tolerance {
+		return fmt.Errorf("timestamp is out of %s window", tolerance)
+	}
+	return nil
+}
+
+// authorized - checks request signature if it's configured, else ?key= parameter
+func (h *SwarmServiceHandler) authorized(r *http.Request, body []byte) bool {
+	if h.config.Signature.enabled() {
+		if err := h.config.Signature.verify(r.Header, body, time.Now()); err != nil {
+			Logz("signature check failed: %s", err)
+			return false
+		}
+		return true
+	}
+	return authorizeKey(&h.config, r, body) == nil
+}
+
+// authorizeKey - ?key= parameter, nothing is accepted without APISecretKey
+func authorizeKey(c *mainConfig, r *http.Request, body []byte) error {
+	if c.APISecretKey == "" {
+		return errors.New("APISecretKey is not configured")
+	}
+	keys := r.URL.Query()[APIWebHookKeyName]
+	if len(keys) == 0 || subtle.ConstantTimeCompare([]byte(keys[0]), []byte(c.APISecretKey)) != 1 {
+		return errors.New("bad " + APIWebHookKeyName)
+	}
+	return nil
+}
+
+// headerTokenMatches - the header carries the token shared with the source
+func headerTokenMatches(r *http.Request, header, want string) error {
+	if want == "" {
+		return errors.New("no token configured for " + header)
+	}
+	value := r.Header.Get(header)
+	if value == "" {
+		return errors.New("missing " + header + " header")
+	}
+	if subtle.ConstantTimeCompare([]byte(value), []byte(want)) != 1 {
+		return errors.New(header + " mismatch")
+	}
+	return nil
+}
+
+// rsaPublicKeys - RSA keys of PEM "CERTIFICATE" and "PUBLIC KEY" blocks
+func rsaPublicKeys(data string) ([]*rsa.PublicKey, error) {
+	var keys []*rsa.PublicKey
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		var key interface{}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			key = cert.PublicKey
+		case "PUBLIC KEY":
+			var err error
+			if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected PEM block %s", block.Type)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("only RSA keys are supported")
+		}
+		keys = append(keys, rsaKey)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM data")
+	}
+	return keys, nil
+}
+
+// authorizedSource - sources with own authentication don't accept ?key= and Signature
+func (h *SwarmServiceHandler) authorizedSource(source webhookSource, r *http.Request, body []byte) bool {
+	if source.authorize == nil {
+		return h.authorized(r, body)
+	}
+	if err := source.authorize(&h.config, r, body); err != nil {
+		Logz("%s auth failed: %s", r.URL.Path, err)
+		return false
+	}
+	return true
+}
+
+// redactedRequestURI - RequestURI without secret key, for logs
+func redactedRequestURI(r *http.Request) string {
+	values := r.URL.Query()
+	if _, ok := values[APIWebHookKeyName]; !ok {
+		return r.RequestURI
+	}
+	values.Set(APIWebHookKeyName, "REDACTED")
+	return r.URL.Path + "?" + values.Encode()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testSignatureSecret = "ohch5Ahkeiph3Ooz"
+
+func testSignature(secret, content string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignatureConfigVerify(t *testing.T) {
+	body := []byte(`{"events": []}`)
+	now := time.Unix(1537000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	simple := signatureConfig{Secret: testSignatureSecret}
+	stamped := signatureConfig{Secret: testSignatureSecret, Header: "X-Hook-Signature", TimestampHeader: "X-Hook-Timestamp"}
+
+	cases := []struct {
+		config  signatureConfig
+		headers map[string]string
+		ok      bool
+	}{
+		{simple, map[string]string{"X-Signature": testSignature(testSignatureSecret, string(body))}, true},
+		{simple, map[string]string{"X-Signature": "sha256=" + testSignature(testSignatureSecret, string(body))}, true},
+		{simple, map[string]string{"X-Signature": testSignature("wrong", string(body))}, false},
+		{simple, map[string]string{"X-Signature": "not-hex"}, false},
+		{simple, map[string]string{}, false},
+		{stamped, map[string]string{"X-Hook-Signature": testSignature(testSignatureSecret, ts+"."+string(body)), "X-Hook-Timestamp": ts}, true},
+		{stamped, map[string]string{"X-Hook-Signature": testSignature(testSignatureSecret, string(body)), "X-Hook-Timestamp": ts}, false},
+		{stamped, map[string]string{"X-Hook-Signature": testSignature(testSignatureSecret, old+"."+string(body)), "X-Hook-Timestamp": old}, false},
+		{stamped, map[string]string{"X-Hook-Signature": testSignature(testSignatureSecret, "."+string(body))}, false},
+		{stamped, map[string]string{"X-Hook-Signature": testSignature(testSignatureSecret, "x."+string(body)), "X-Hook-Timestamp": "x"}, false},
+	}
+	for idx, c := range cases {
+		header := http.Header{}
+		for k, v := range c.headers {
+			header.Set(k, v)
+		}
+		err := c.config.verify(header, body, now)
+		if c.ok != (err == nil) {
+			t.Errorf("case %d: expected ok=%v, got error: %v", idx, c.ok, err)
+		}
+	}
+}
+
+func TestSignedWebhook(t *testing.T) {
+	config := testConfig
+	config.Signature = signatureConfig{Secret: testSignatureSecret}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	cases := []Case{
+		{ // case 0: key is not enough in signature mode
+			Path:    APIEndpointWebHookDockerHub,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadDockerHub,
+			Result: CR{
+				"error": "unauthorized",
+			},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookDockerHub,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadDockerHub,
+			Headers: map[string]string{defaultSignatureHeader: testSignature(testSignatureSecret, payloadDockerHub)},
+			Result:  unmappedResult("svendowideit/testhook:latest"),
+		},
+	}
+
+	runTests(t, ts, cases, config)
+}
+
+func TestAuthorizeKeyEmpty(t *testing.T) {
+	config := testConfig
+	config.APISecretKey = ""
+	r := httptest.NewRequest(http.MethodPost, APIEndpointWebHookRegistry+"?"+APIWebHookKeyName+"=", nil)
+	if err := authorizeKey(&config, r, nil); err == nil {
+		t.Errorf("empty key must not be accepted")
+	}
+}
+
+func TestHeaderTokenMatches(t *testing.T) {
+	cases := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"Uo5eiquu", "Uo5eiquu", true},
+		{"other", "Uo5eiquu", false},
+		{"", "Uo5eiquu", false},
+		{"", "", false},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, APIEndpointWebHookACR, nil)
+		if c.value != "" {
+			r.Header.Set("X-Ddw-Token", c.value)
+		}
+		if err := headerTokenMatches(r, "X-Ddw-Token", c.want); c.ok != (err == nil) {
+			t.Errorf("case %d: expected ok=%v, got error: %v", i, c.ok, err)
+		}
+	}
+}
+
+func TestRedactedRequestURI(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, APIEndpointWebHookRegistry+"?key=secret&a=b", nil)
+	if uri := redactedRequestURI(r); uri != APIEndpointWebHookRegistry+"?a=b&key=REDACTED" {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+	r = httptest.NewRequest(http.MethodPost, APIEndpointWebHookRegistry, nil)
+	if uri := redactedRequestURI(r); uri != APIEndpointWebHookRegistry {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+}
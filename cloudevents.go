@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	cloudEventsSpecVersion  = "1.0"
+	cloudEventsContentType  = "application/cloudevents+json"
+	cloudEventsBatchType    = "application/cloudevents-batch+json"
+	cloudEventsBinaryHeader = "Ce-Specversion"
+)
+
+// cloudEventsConfig - CloudEvents 1.0 of the configured types, the rest is ignored
+type cloudEventsConfig struct {
+	Types map[string]cloudEventMapping // map[event type]fields of data
+}
+
+// cloudEventMapping - dotted paths of image fields in the event data, e.g. "artifact.image".
+// Tag is optional, for events which carry repository and tag separately.
+type cloudEventMapping struct {
+	Image  string
+	Tag    string
+	Digest string
+
+	image, tag, digest jsonPath // set by validate
+}
+
+// validate - checks the mappings and compiles their paths
+func (c *cloudEventsConfig) validate() error {
+	for eventType, mapping := range c.Types {
+		if eventType == "" {
+			return errors.New("bad CloudEvents.Types: empty event type")
+		}
+		if mapping.Image == "" {
+			return fmt.Errorf("bad CloudEvents.Types mapping for '%s': empty Image", eventType)
+		}
+		fields := []struct {
+			name string
+			expr string
+			dst  *jsonPath
+		}{
+			{"Image", mapping.Image, &mapping.image},
+			{"Tag", mapping.Tag, &mapping.tag},
+			{"Digest", mapping.Digest, &mapping.digest},
+		}
+		for _, field := range fields {
+			if field.expr == "" {
+				continue
+			}
+			path, err := parseJSONPath("$." + field.expr)
+			if err != nil {
+				return fmt.Errorf("bad CloudEvents.Types mapping for '%s': bad %s: %s", eventType, field.name, err)
+			}
+			*field.dst = path
+		}
+		c.Types[eventType] = mapping
+	}
+	return nil
+}
+
+// cloudEvent - attributes of the event we use, data is the raw json of the structured mode
+// or the body in the binary mode
+type cloudEvent struct {
+	SpecVersion string `json:"specversion"`
+	ID          string
+	Type        string
+	Data        json.RawMessage
+	DataBase64  []byte `json:"data_base64"`
+}
+
+// cloudEventsFromRequest - events of structured, batched and binary content modes
+func cloudEventsFromRequest(header http.Header, data []byte) ([]cloudEvent, error) {
+	if header.Get(cloudEventsBinaryHeader) != "" {
+		return []cloudEvent{{
+			SpecVersion: header.Get(cloudEventsBinaryHeader),
+			ID:          header.Get("Ce-Id"),
+			Type:        header.Get("Ce-Type"),
+			Data:        data,
+		}}, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == cloudEventsBatchType {
+		var events []cloudEvent
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, err
+		}
+		return events, nil
+	}
+	var event cloudEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return []cloudEvent{event}, nil
+}
+
+func (h *SwarmServiceHandler) cloudEventsPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return result, err
+	}
+	events, err := cloudEventsFromRequest(header, data)
+	if err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %d events", APIEndpointWebHookCloudEvents, len(events))
+	if len(events) == 0 {
+		return result, errors.New("payload without events")
+	}
+	for _, event := range events {
+		params, reason := h.config.cloudEventParams(event)
+		if reason != "" {
+			result.ignore(event.ID, params.registryImage, reason)
+			continue
+		}
+		params.serviceNames = h.config.servicesFor(params.registryImage)
+		result.add(params)
+	}
+	return result, nil
+}
+
+// cloudEventParams - image of the event or the reason why it's not deployable
+func (c *mainConfig) cloudEventParams(event cloudEvent) (HookParamsFromPayload, string) {
+	var params HookParamsFromPayload
+	if event.SpecVersion != cloudEventsSpecVersion {
+		return params, "specversion " + event.SpecVersion + " is not supported"
+	}
+	mapping, ok := c.CloudEvents.Types[event.Type]
+	if !ok {
+		return params, "event type " + event.Type + " is not mapped"
+	}
+	raw := []byte(event.Data)
+	if len(event.DataBase64) > 0 {
+		raw = event.DataBase64
+	}
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return params, "data is not json: " + err.Error()
+	}
+
+	params.registryImage = mapping.image.stringValue(data)
+	if params.registryImage == "" {
+		return params, "no image in " + mapping.Image
+	}
+	if mapping.Tag != "" {
+		tag := mapping.tag.stringValue(data)
+		if tag == "" {
+			return params, "push without tag"
+		}
+		params.registryImage += ":" + tag
+	}
+	if mapping.Digest != "" {
+		// image@sha256:... as well as sha256:...
+		digest := mapping.digest.stringValue(data)
+		params.digest = digest[strings.LastIndex(digest, "@")+1:]
+	}
+	return params, ""
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCloudEventsWebhook(t *testing.T) {
+	config := testConfig
+	config.CloudEvents = cloudEventsConfig{Types: map[string]cloudEventMapping{
+		"com.example.image.pushed": {Image: "image", Digest: "digest"},
+		"com.example.build.done":   {Image: "artifact.repository", Tag: "artifact.tag", Digest: "artifact.digest"},
+	}}
+	if err := config.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	query := fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey)
+	structured := `{"specversion": "1.0", "id": "A234-1234-1234", "source": "/ci", "type": "com.example.image.pushed", "datacontenttype": "application/json", "data": {"image": "vorona/app:latest", "digest": "sha256:0123"}}`
+	unmapped := `{"specversion": "1.0", "id": "B234-1234-1234", "source": "/ci", "type": "com.example.test.done", "data": {}}`
+
+	cases := []Case{
+		{ // case 0
+			Path:    APIEndpointWebHookCloudEvents,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: structured,
+			Headers: map[string]string{"Content-Type": cloudEventsContentType},
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1: structured mode
+			Path:    APIEndpointWebHookCloudEvents,
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusOK,
+			Payload: structured,
+			Headers: map[string]string{"Content-Type": cloudEventsContentType + "; charset=utf-8"},
+			Result:  unmappedResult("vorona/app:latest"),
+		},
+		{ // case 2: binary mode
+			Path:    APIEndpointWebHookCloudEvents,
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusOK,
+			Payload: `{"artifact": {"repository": "vorona/app", "tag": "1.4.0"}}`,
+			Headers: map[string]string{
+				"Content-Type":   "application/json",
+				"ce-specversion": "1.0",
+				"ce-id":          "C234-1234-1234",
+				"ce-source":      "/ci",
+				"ce-type":        "com.example.build.done",
+			},
+			Result: unmappedResult("vorona/app:1.4.0"),
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookCloudEvents,
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusOK,
+			Payload: unmapped,
+			Headers: map[string]string{"Content-Type": cloudEventsContentType},
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"event": "B234-1234-1234", "reason": "event type com.example.test.done is not mapped"}}},
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookCloudEvents,
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusBadRequest,
+			Payload: `[]`,
+			Headers: map[string]string{"Content-Type": cloudEventsBatchType},
+			Result:  CR{"error": "can't decode payload: payload without events"},
+		},
+	}
+	runTests(t, ts, cases, config)
+}
+
+func TestCloudEventsBatch(t *testing.T) {
+	config := testConfig
+	config.Services = map[string]serviceList{"vorona/app:latest": {"app"}}
+	config.CloudEvents = cloudEventsConfig{Types: map[string]cloudEventMapping{
+		"com.example.image.pushed": {Image: "image", Digest: "digest"},
+		"com.example.build.done":   {Image: "artifact.repository", Tag: "artifact.tag"},
+	}}
+	if err := config.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+	batch := `[
+  {"specversion": "1.0", "id": "1", "source": "/ci", "type": "com.example.image.pushed", "data_base64": "eyJpbWFnZSI6ICJ2b3JvbmEvYXBwOmxhdGVzdCIsICJkaWdlc3QiOiAidm9yb25hL2FwcEBzaGEyNTY6MDEyMyJ9"},
+  {"specversion": "0.3", "id": "2", "source": "/ci", "type": "com.example.image.pushed", "data": {"image": "vorona/app:latest"}},
+  {"specversion": "1.0", "id": "3", "source": "/ci", "type": "com.example.image.pushed", "data": {"name": "vorona/app:latest"}},
+  {"specversion": "1.0", "id": "4", "source": "/ci", "type": "com.example.build.done", "data": {"artifact": {"repository": "vorona/app"}}}
+]`
+
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(batch), APIEndpointWebHookCloudEvents, http.Header{"Content-Type": {cloudEventsBatchType}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedTargets := []HookParamsFromPayload{{"vorona/app:latest", "sha256:0123", []string{"app"}}}
+	if !reflect.DeepEqual(payload.targets, expectedTargets) {
+		t.Errorf("expected targets %+v, got %+v", expectedTargets, payload.targets)
+	}
+	expectedIgnored := []ignoredEvent{
+		{"2", "", "specversion 0.3 is not supported"},
+		{"3", "", "no image in image"},
+		{"4", "vorona/app", "push without tag"},
+	}
+	if !reflect.DeepEqual(payload.ignored, expectedIgnored) {
+		t.Errorf("expected ignored %+v, got %+v", expectedIgnored, payload.ignored)
+	}
+
+	if _, err := parseConfig([]byte(`{"CloudEvents": {"Types": {"com.example.image.pushed": {"Digest": "digest"}}}}`)); err == nil {
+		t.Errorf("expected error for mapping without Image")
+	}
+	if _, err := parseConfig([]byte(`{"CloudEvents": {"Types": {"com.example.image.pushed": {"Image": "artifact..image"}}}}`)); err == nil {
+		t.Errorf("expected error for bad Image path")
+	}
+}
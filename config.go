@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"docker.io/go-docker/api/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	configFileENVName           = "DDW_CONFIG_FILE"
+	configReloadENVName         = "DDW_CONFIG_RELOAD_INTERVAL"
+	defaultConfigReloadInterval = 5 * time.Second
+)
+
+// loadConfig - reads config from the file DDW_CONFIG_FILE if it's set, else from base64 DDW_CONFIG
+func loadConfig() (mainConfig, []byte, errExt) {
+	if path := os.Getenv(configFileENVName); path != "" {
+		rawConfig, err := ioutil.ReadFile(path)
+		if err != nil {
+			return mainConfig{}, nil, errExt{fmt.Sprintf("can't read config file ENV[%s]: %s", configFileENVName, path), err}
+		}
+		Logz("got config file %s", path)
+		config, err := parseConfig(rawConfig)
+		if err != nil {
+			return mainConfig{}, nil, errExt{fmt.Sprintf("can't decode config file: '%s'", path), err}
+		}
+		return config, rawConfig, errExt{"OK", nil}
+	}
+
+	rawConfig, err := base64.URLEncoding.DecodeString(os.Getenv(configENVName))
+	if err != nil {
+		return mainConfig{}, nil, errExt{fmt.Sprintf("can't decode base64 value ENV[%s]: %s", configENVName, os.Getenv(configENVName)), err}
+	}
+	Logz("got environ param %s", configENVName)
+	config, err := parseConfig(rawConfig)
+	if err != nil {
+		return mainConfig{}, nil, errExt{fmt.Sprintf("can't decode json value: '%s'", rawConfig), err}
+	}
+	return config, rawConfig, errExt{"OK", nil}
+}
+
+func parseConfig(rawConfig []byte) (mainConfig, error) {
+	var config mainConfig
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return config, err
+	}
+	return config, config.validate()
+}
+
+// validate - checks things json.Unmarshal can't check for us
+func (c *mainConfig) validate() error {
+	for image, services := range c.Services {
+		if image == "" {
+			return errors.New("bad Services mapping: empty image")
+		}
+		if err := services.validate(); err != nil {
+			return fmt.Errorf("bad Services mapping for '%s': %s", image, err)
+		}
+	}
+	for i := range c.Rules {
+		if err := c.Rules[i].validate(); err != nil {
+			return fmt.Errorf("bad Rules[%d]: %s", i, err)
+		}
+	}
+	for i, mediaType := range c.MediaTypes {
+		if mediaType == "" {
+			return fmt.Errorf("bad MediaTypes[%d]: empty media type", i)
+		}
+	}
+	if c.ECR.Certificate != "" {
+		if _, err := c.ECR.publicKeys(); err != nil {
+			return err
+		}
+	}
+	if err := c.CloudEvents.validate(); err != nil {
+		return err
+	}
+	if err := c.validateGeneric(); err != nil {
+		return err
+	}
+	if c.GCR.PublicKey != "" {
+		if _, err := rsaPublicKeys(c.GCR.PublicKey); err != nil {
+			return fmt.Errorf("bad GCR.PublicKey: %s", err)
+		}
+		if c.GCR.Audience == "" {
+			return errors.New("GCR.Audience is required with GCR.PublicKey")
+		}
+	}
+	return nil
+}
+
+// duration - time.Duration which is "30s", "5m" etc in json
+type duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON - accepts time.ParseDuration strings
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("duration must be a string like \"30s\"")
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = value
+	return nil
+}
+
+// MarshalJSON - the same format UnmarshalJSON accepts
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// reloadableHandler - holds current SwarmServiceHandler and swaps it atomically,
+// so requests in flight finish with the config they started with
+type reloadableHandler struct {
+	current atomic.Value // *SwarmServiceHandler
+}
+
+func newReloadableHandler(h *SwarmServiceHandler) *reloadableHandler {
+	rh := &reloadableHandler{}
+	rh.current.Store(h)
+	return rh
+}
+
+func (rh *reloadableHandler) load() *SwarmServiceHandler {
+	return rh.current.Load().(*SwarmServiceHandler)
+}
+
+// store - replaces config, update options except auth data are kept from the current handler
+func (rh *reloadableHandler) store(config mainConfig) {
+	updateOpts := rh.load().updateOpts
+	updateOpts.RegistryAuthFrom = createBase64AuthData(config.PrivateRegistry)
+	rh.current.Store(&SwarmServiceHandler{config, updateOpts})
+}
+
+func (rh *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rh.load().ServeHTTP(w, r)
+}
+
+// configWatcher - polls config file and reloads it on change.
+// Polling (not inotify) because mounted swarm configs/secrets and k8s-style
+// volumes are replaced by symlink swaps which inotify watchers easily miss.
+type configWatcher struct {
+	path     string
+	interval time.Duration
+	handler  *reloadableHandler
+	last     []byte
+}
+
+func newConfigWatcher(path string, handler *reloadableHandler, last []byte) *configWatcher {
+	interval := defaultConfigReloadInterval
+	if d, err := time.ParseDuration(os.Getenv(configReloadENVName)); err == nil && d > 0 {
+		interval = d
+	}
+	return &configWatcher{path, interval, handler, last}
+}
+
+func (cw *configWatcher) run(stop <-chan struct{}) {
+	Logz("watching config file %s every %s", cw.path, cw.interval)
+	ticker := time.NewTicker(cw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := cw.check(); err != nil {
+				Logz("config reload rejected, keeping last good config: %s", err)
+			}
+		}
+	}
+}
+
+// check - reloads config if file content was changed. On error the current config stays untouched.
+func (cw *configWatcher) check() error {
+	rawConfig, err := ioutil.ReadFile(cw.path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(rawConfig, cw.last) {
+		return nil
+	}
+	// remember rejected content too, so the same broken file isn't reported on every tick
+	cw.last = rawConfig
+	if len(bytes.TrimSpace(rawConfig)) == 0 {
+		return errors.New("config file is empty")
+	}
+	config, err := parseConfig(rawConfig)
+	if err != nil {
+		return err
+	}
+	cw.handler.store(config)
+	Logz("config reloaded from %s", cw.path)
+	return nil
+}
+
+func newUpdateOpts(config mainConfig) types.ServiceUpdateOptions {
+	return types.ServiceUpdateOptions{
+		QueryRegistry:    true,
+		RegistryAuthFrom: createBase64AuthData(config.PrivateRegistry),
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeTestConfigFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("can't write config file: %s", err)
+	}
+}
+
+func TestLoadConfigFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "ddw-config")
+	if err != nil {
+		t.Fatalf("can't create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	raw, _ := json.Marshal(testConfig)
+	writeTestConfigFile(t, f.Name(), raw)
+	if err := os.Setenv(configFileENVName, f.Name()); err != nil {
+		t.Errorf("can't set OS environ with error: %s", err)
+	}
+	defer os.Setenv(configFileENVName, "")
+
+	config, _, errC := loadConfig()
+	if errC.Err != nil {
+		t.Fatalf("unexpected error: %s", errC.Explain)
+	}
+	if config.APISecretKey != testConfig.APISecretKey {
+		t.Errorf("expected key %s, got %s", testConfig.APISecretKey, config.APISecretKey)
+	}
+
+	writeTestConfigFile(t, f.Name(), []byte("{Bad json}"))
+	if _, _, errC := loadConfig(); errC.Err == nil {
+		t.Errorf("expected error on bad config file")
+	}
+
+	os.Setenv(configFileENVName, "/file/path/name.json")
+	if _, _, errC := loadConfig(); errC.Err == nil {
+		t.Errorf("expected error on missing config file")
+	}
+}
+
+func TestConfigWatcherReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "ddw-config")
+	if err != nil {
+		t.Fatalf("can't create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	raw, _ := json.Marshal(testConfig)
+	writeTestConfigFile(t, f.Name(), raw)
+	handler := newReloadableHandler(&SwarmServiceHandler{testConfig, testUpdateOpts})
+	inFlight := handler.load()
+	cw := newConfigWatcher(f.Name(), handler, raw)
+
+	if err := cw.check(); err != nil || handler.load() != inFlight {
+		t.Errorf("unchanged file must not reload config, err: %v", err)
+	}
+
+	newConfig := testConfig
+	newConfig.APISecretKey = "new-key"
+	raw, _ = json.Marshal(newConfig)
+	writeTestConfigFile(t, f.Name(), raw)
+	if err := cw.check(); err != nil {
+		t.Errorf("unexpected reload error: %s", err)
+	}
+	if key := handler.load().config.APISecretKey; key != "new-key" {
+		t.Errorf("config wasn't reloaded, got key %s", key)
+	}
+	if handler.load().updateOpts.QueryRegistry != testUpdateOpts.QueryRegistry {
+		t.Errorf("update options must survive reload")
+	}
+	if inFlight.config.APISecretKey != testConfig.APISecretKey {
+		t.Errorf("handler in flight must keep its config")
+	}
+
+	badConfigs := []string{
+		"",
+		"{Bad json}",
+		`{"Services": {"vorona/docker-deploy-webhook:latest": ""}}`,
+	}
+	for _, bad := range badConfigs {
+		writeTestConfigFile(t, f.Name(), []byte(bad))
+		if err := cw.check(); err == nil {
+			t.Errorf("expected error for config: %s", bad)
+		}
+		if key := handler.load().config.APISecretKey; key != "new-key" {
+			t.Errorf("bad config must keep last good config, got key %s", key)
+		}
+	}
+
+	os.Remove(f.Name())
+	if err := cw.check(); err == nil {
+		t.Errorf("expected error on removed config file")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/filters"
+	"docker.io/go-docker/api/types/swarm"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultConvergenceTimeout      = 5 * time.Minute
+	defaultConvergencePollInterval = 2 * time.Second
+
+	// rolloutStateTimeout - not a swarm state, the update didn't finish in time
+	rolloutStateTimeout = "timeout"
+)
+
+// convergenceConfig - wait until swarm finishes the rolling update and report its real outcome
+type convergenceConfig struct {
+	Enabled      bool
+	Timeout      duration // default 5m
+	PollInterval duration // default 2s
+}
+
+func (c *convergenceConfig) timeout() time.Duration {
+	if c.Timeout.Duration > 0 {
+		return c.Timeout.Duration
+	}
+	return defaultConvergenceTimeout
+}
+
+func (c *convergenceConfig) pollInterval() time.Duration {
+	if c.PollInterval.Duration > 0 {
+		return c.PollInterval.Duration
+	}
+	return defaultConvergencePollInterval
+}
+
+// rollout - final state of a service update
+type rollout struct {
+	State      string
+	Message    string
+	TaskErrors []string
+}
+
+func (r *rollout) succeeded() bool {
+	return r.State == string(swarm.UpdateStateCompleted)
+}
+
+var terminalUpdateStates = map[swarm.UpdateState]bool{
+	swarm.UpdateStateCompleted:         true,
+	swarm.UpdateStatePaused:            true,
+	swarm.UpdateStateRollbackCompleted: true,
+	swarm.UpdateStateRollbackPaused:    true,
+}
+
+// isNewUpdate - true if status belongs to an update started after the before snapshot
+func isNewUpdate(before, status *swarm.UpdateStatus) bool {
+	if status == nil || status.StartedAt == nil {
+		return false
+	}
+	return before == nil || before.StartedAt == nil || !status.StartedAt.Equal(*before.StartedAt)
+}
+
+// waitForConvergence - polls the service until its update reaches a terminal state or timeout expires.
+// before is the service as it was inspected right before ServiceUpdate.
+func (h *SwarmServiceHandler) waitForConvergence(before swarm.Service) (rollout, error) {
+	config := h.config.Convergence
+	defer inFlightDeploys.start("waiting for %s convergence", before.Spec.Name)()
+	ctx, cancel := context.WithTimeout(context.Background(), config.timeout())
+	defer cancel()
+
+	cli, err := docker.NewEnvClient()
+	if err != nil {
+		return rollout{}, fmt.Errorf("can't connect to docker host: %s", err)
+	}
+	defer withouterrIOClose(cli)
+
+	result, err := pollRollout(ctx, cli, before, config.pollInterval())
+	if err != nil {
+		return rollout{}, err
+	}
+	if result.State == rolloutStateTimeout {
+		Logz("service %s didn't converge in %s", before.Spec.Name, config.timeout())
+	}
+
+	// tasks are listed with a fresh context, the waiting one may be already expired
+	result.TaskErrors = failedTasks(cli, before)
+	Logz("service %s rollout: %s %s %v", before.Spec.Name, result.State, result.Message, result.TaskErrors)
+	return result, nil
+}
+
+func pollRollout(ctx context.Context, cli *docker.Client, before swarm.Service, interval time.Duration) (rollout, error) {
+	last := rollout{State: "not started"}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		service, _, err := cli.ServiceInspectWithRaw(ctx, before.ID, types.ServiceInspectOptions{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return timedOut(last), nil
+			}
+			return rollout{}, fmt.Errorf("can't inspect service %s: %s", before.Spec.Name, err)
+		}
+		if status := service.UpdateStatus; isNewUpdate(before.UpdateStatus, status) {
+			last = rollout{State: string(status.State), Message: status.Message}
+			if terminalUpdateStates[status.State] {
+				return last, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return timedOut(last), nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func timedOut(last rollout) rollout {
+	return rollout{
+		State:   rolloutStateTimeout,
+		Message: strings.TrimSpace(fmt.Sprintf("last state: %s %s", last.State, last.Message)),
+	}
+}
+
+// failedTasks - errors of tasks which failed after the update was submitted
+func failedTasks(cli *docker.Client, before swarm.Service) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tasks, err := cli.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", before.ID)),
+	})
+	if err != nil {
+		Logz("can't list tasks of %s: %s", before.Spec.Name, err)
+		return nil
+	}
+	var taskErrors []string
+	for _, task := range tasks {
+		if task.Status.Err == "" || !task.CreatedAt.After(before.UpdatedAt) {
+			continue
+		}
+		taskErrors = append(taskErrors, fmt.Sprintf("task %s: %s: %s", task.ID, task.Status.State, task.Status.Err))
+	}
+	return taskErrors
+}
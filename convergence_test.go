@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// fakeOldImage - the pushed tag with the digest of the previous push
+	fakeOldImage = "docker-registry.private-host.com/projectq-app:latest@sha256:c72e6f0209f1d7feecb526e9a26fc276577538c4b840278bd9734d8fcb5cd180"
+	// fakeNewImage - the pushed tag with the digest of payloadDockerService
+	fakeNewImage = "docker-registry.private-host.com/projectq-app:latest@sha256:791de1ee1a11daaf65379856704197e3a7f64e54cb1a8e8e875b8d658b4adbd2"
+)
+
+const fakeUpdateStatus = `"UpdateStatus":{"State":"completed","StartedAt":"2018-09-16T22:12:23.2894165Z","CompletedAt":"2018-09-16T22:13:00.88211065Z","Message":"update completed"}`
+
+// fakeServiceWithUpdateStatus - fakeServiceInspectBody after a new update was started
+func fakeServiceWithUpdateStatus(state, message string) []byte {
+	status := fmt.Sprintf(`"UpdateStatus":{"State":"%s","StartedAt":"2018-09-23T10:00:00Z","Message":"%s"}`, state, message)
+	return []byte(strings.Replace(fakeServiceInspectBody, fakeUpdateStatus, status, 1))
+}
+
+// fakeServiceRunning - fakeServiceInspectBody before the update, running image
+func fakeServiceRunning(image string) []byte {
+	return []byte(strings.Replace(fakeServiceInspectBody,
+		`"Image":"docker-registry.private-host.com/projectq-app:latest",`, `"Image":"`+image+`",`, 1))
+}
+
+func TestSwarmWaitForConvergence(t *testing.T) {
+	config := testConfig
+	config.Convergence = convergenceConfig{
+		Enabled:      true,
+		Timeout:      duration{50 * time.Millisecond},
+		PollInterval: duration{5 * time.Millisecond},
+	}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	stale := make([]DResp, 0, 40)
+	stale = append(stale, DResp{http.StatusOK, fakeServiceRunning(fakeOldImage)}, DResp{http.StatusOK, []byte(`{}`)})
+	for len(stale) < cap(stale) {
+		stale = append(stale, DResp{http.StatusOK, []byte(fakeServiceInspectBody)})
+	}
+
+	pausedErr := "rollout of projectq-stack-latest_backend paused: update paused due to failure or early termination of task 1"
+	timeoutErr := "rollout of projectq-stack-latest_backend timeout: last state: not started"
+	cases := []Case{
+		{ // case 0
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusOK,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, fakeServiceRunning(fakeOldImage)},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, []byte(fakeServiceInspectBody)},
+				{http.StatusOK, fakeServiceWithUpdateStatus("updating", "update in progress")},
+				{http.StatusOK, fakeServiceWithUpdateStatus("completed", "update completed")},
+				{http.StatusOK, []byte(`[]`)},
+			},
+			Result: CR{
+				"status": "OK",
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "docker-registry.private-host.com/projectq-app:latest",
+					"status":  "OK",
+					"state":   "completed",
+				}},
+			},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusBadRequest,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, fakeServiceRunning(fakeOldImage)},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, []byte(fakeServiceInspectBody)},
+				{http.StatusOK, fakeServiceWithUpdateStatus("paused", "update paused due to failure or early termination of task 1")},
+				{http.StatusOK, []byte(`[
+					{"ID": "1", "CreatedAt": "2018-09-23T10:00:01Z", "Status": {"State": "failed", "Err": "task: non-zero exit (1)"}},
+					{"ID": "0", "CreatedAt": "2018-09-15T10:00:01Z", "Status": {"State": "failed", "Err": "old failure"}},
+					{"ID": "2", "CreatedAt": "2018-09-23T10:00:02Z", "Status": {"State": "running"}}
+				]`)},
+			},
+			Result: CR{
+				"error": pausedErr,
+				"services": []CR{{
+					"service":     "projectq-stack-latest_backend",
+					"image":       "docker-registry.private-host.com/projectq-app:latest",
+					"status":      "FAILED",
+					"error":       pausedErr,
+					"state":       "paused",
+					"task_errors": []string{"task 1: failed: task: non-zero exit (1)"},
+				}},
+			},
+		},
+		{ // case 2: swarm never reports the new update
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusBadRequest,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp:   stale,
+			Result: CR{
+				"error": timeoutErr,
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "docker-registry.private-host.com/projectq-app:latest",
+					"status":  "FAILED",
+					"error":   timeoutErr,
+					"state":   "timeout",
+				}},
+			},
+		},
+		{ // case 3: duplicate notification, the service already runs the pushed digest
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusOK,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, fakeServiceRunning(fakeNewImage)},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, fakeServiceRunning(fakeNewImage)},
+			},
+			Result: CR{
+				"status": "OK",
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "docker-registry.private-host.com/projectq-app:latest",
+					"status":  "OK",
+					"state":   "completed",
+				}},
+			},
+		},
+	}
+
+	runTests(t, ts, cases, config)
+
+	// a digest-less hook for the image the service already runs isn't waited for either
+	config.Services = map[string]serviceList{"quay.io/vorona/app:latest": {"projectq-stack-latest_backend"}}
+	ts = httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	quayRunning := fakeServiceRunning("quay.io/vorona/app:latest@sha256:791de1ee1a11")
+	quayCase := cases[3]
+	quayCase.Path = APIEndpointWebHookQuay
+	quayCase.Payload = `{"docker_url": "quay.io/vorona/app", "updated_tags": ["latest"]}`
+	quayCase.DResp = []DResp{
+		{http.StatusOK, quayRunning},
+		{http.StatusOK, []byte(`{}`)},
+		{http.StatusOK, quayRunning},
+	}
+	quayCase.Result = CR{
+		"status": "OK",
+		"services": []CR{{
+			"service": "projectq-stack-latest_backend",
+			"image":   "quay.io/vorona/app:latest",
+			"status":  "OK",
+			"state":   "completed",
+		}},
+	}
+	runTests(t, ts, []Case{quayCase}, config)
+}
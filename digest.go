@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"docker.io/go-docker"
+	"fmt"
+	"strings"
+)
+
+// pinnedImage - returns "repo:tag@sha256:..." reference, image which is already pinned is kept as is
+func pinnedImage(image, digest string) string {
+	if digest == "" || strings.Contains(image, "@") {
+		return image
+	}
+	return image + "@" + digest
+}
+
+// resolveDigest - asks the engine (and the engine asks registry) for the current digest of image.
+// Used for Docker Hub hooks, their payload doesn't carry a digest.
+func (h *SwarmServiceHandler) resolveDigest(image string) (string, error) {
+	cli, err := docker.NewEnvClient()
+	if err != nil {
+		return "", fmt.Errorf("can't connect to docker host: %s", err)
+	}
+	defer withouterrIOClose(cli)
+	// RegistryAuthFrom holds base64 auth data, see createBase64AuthData()
+	inspect, err := cli.DistributionInspect(context.Background(), image, h.updateOpts.RegistryAuthFrom)
+	if err != nil {
+		return "", fmt.Errorf("can't resolve digest of %s: %s", image, err)
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
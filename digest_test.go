@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPinnedImage(t *testing.T) {
+	cases := [][3]string{
+		{"app:latest", "", "app:latest"},
+		{"app:latest", "sha256:0123", "app:latest@sha256:0123"},
+		{"app:latest@sha256:0123", "sha256:4567", "app:latest@sha256:0123"},
+	}
+	for _, c := range cases {
+		if image := pinnedImage(c[0], c[1]); image != c[2] {
+			t.Errorf("expected %s, got %s", c[2], image)
+		}
+	}
+}
+
+func TestRegistryPayloadDigest(t *testing.T) {
+	h := &SwarmServiceHandler{testConfig, testUpdateOpts}
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(payloadDockerService), APIEndpointWebHookRegistry, nil)
+	if err != nil || len(payload.targets) != 1 {
+		t.Fatalf("unexpected error: %v %+v", err, payload)
+	}
+	params := payload.targets[0]
+	expected := "sha256:791de1ee1a11daaf65379856704197e3a7f64e54cb1a8e8e875b8d658b4adbd2"
+	if params.digest != expected {
+		t.Errorf("expected digest %s, got %s", expected, params.digest)
+	}
+}
+
+func TestSwarmPinDigestDockerHub(t *testing.T) {
+	config := testConfig
+	config.PinDigest = true
+	config.Services = map[string]serviceList{
+		"svendowideit/testhook:latest": {"testhook_web", "testhook_worker"},
+	}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	distributionErr := "can't resolve digest of svendowideit/testhook:latest: Error response from daemon: {}"
+	cases := []Case{
+		{ // case 0: digest resolved once for both services
+			Path:    APIEndpointWebHookDockerHub,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusOK,
+			Payload: payloadDockerHub,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{statusCode: http.StatusOK, responseBody: []byte(`{"Descriptor": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "digest": "sha256:c72e6f0209f1d7feecb526e9a26fc276577538c4b840278bd9734d8fcb5cd180", "size": 1995}}`)},
+				{statusCode: http.StatusOK, responseBody: []byte(fakeServiceInspectBody)},
+				{statusCode: http.StatusOK, responseBody: []byte(`{}`)},
+				{statusCode: http.StatusOK, responseBody: []byte(fakeServiceInspectBody)},
+				{statusCode: http.StatusOK, responseBody: []byte(`{}`)},
+			},
+			Result: CR{
+				"status": "OK",
+				"services": []CR{
+					{"service": "testhook_web", "image": "svendowideit/testhook:latest", "status": "OK"},
+					{"service": "testhook_worker", "image": "svendowideit/testhook:latest", "status": "OK"},
+				},
+			},
+		},
+		{ // case 1: digest can't be resolved, nothing is updated
+			Path:    APIEndpointWebHookDockerHub,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusBadRequest,
+			Payload: payloadDockerHub,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{statusCode: http.StatusForbidden, responseBody: []byte(`{}`)},
+			},
+			Result: CR{
+				"error": distributionErr + "; " + distributionErr,
+				"services": []CR{
+					{"service": "testhook_web", "image": "svendowideit/testhook:latest", "status": "FAILED", "error": distributionErr},
+					{"service": "testhook_worker", "image": "svendowideit/testhook:latest", "status": "FAILED", "error": distributionErr},
+				},
+			},
+		},
+	}
+
+	runTests(t, ts, cases, config)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	snsTypeNotification             = "Notification"
+	snsTypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	ecrDetailTypeImageAction        = "ECR Image Action"
+	ecrActionPush                   = "PUSH"
+	ecrResultSuccess                = "SUCCESS"
+)
+
+// snsClient - confirms SNS subscriptions
+var snsClient = &http.Client{Timeout: 10 * time.Second}
+
+// ecrConfig - ECR events of EventBridge delivered by an SNS HTTP(S) subscription.
+// Messages are verified with the SNS signing certificates of the region (PEM),
+// SigningCertURL of the message is never fetched.
+type ecrConfig struct {
+	Certificate string
+	TopicArn    string // optional, accept messages of this topic only
+}
+
+func (c *ecrConfig) publicKeys() ([]*rsa.PublicKey, error) {
+	keys, err := rsaPublicKeys(c.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("bad ECR.Certificate: %s", err)
+	}
+	return keys, nil
+}
+
+// snsMessage - SNS HTTP(S) delivery
+type snsMessage struct {
+	Type             string
+	MessageID        string
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SubscribeURL     string
+}
+
+// stringToSign - name/value lines in the order SNS signs them, Subject only if it's set
+func (m *snsMessage) stringToSign() string {
+	fields := [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}}
+	if m.Type == snsTypeNotification {
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+	} else {
+		fields = append(fields, [2]string{"SubscribeURL", m.SubscribeURL})
+	}
+	fields = append(fields, [2]string{"Timestamp", m.Timestamp})
+	if m.Type != snsTypeNotification {
+		fields = append(fields, [2]string{"Token", m.Token})
+	}
+	fields = append(fields, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+
+	var s string
+	for _, field := range fields {
+		s += field[0] + "\n" + field[1] + "\n"
+	}
+	return s
+}
+
+// verify - SignatureVersion 1 is SHA1withRSA, 2 is SHA256withRSA
+func (m *snsMessage) verify(key *rsa.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("bad Signature: %s", err)
+	}
+	var hash crypto.Hash
+	var hashed []byte
+	switch m.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(m.stringToSign()))
+		hash, hashed = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256([]byte(m.stringToSign()))
+		hash, hashed = crypto.SHA256, sum[:]
+	default:
+		return fmt.Errorf("unsupported SignatureVersion '%s'", m.SignatureVersion)
+	}
+	return rsa.VerifyPKCS1v15(key, hash, hashed, signature)
+}
+
+// ecrEvent - EventBridge "ECR Image Action" event
+type ecrEvent struct {
+	DetailType string `json:"detail-type"`
+	Account    string
+	Region     string
+	Detail     struct {
+		Result         string
+		ActionType     string `json:"action-type"`
+		RepositoryName string `json:"repository-name"`
+		ImageDigest    string `json:"image-digest"`
+		ImageTag       string `json:"image-tag"`
+	}
+}
+
+func authorizeECR(c *mainConfig, r *http.Request, body []byte) error {
+	if c.ECR.Certificate == "" {
+		return errors.New("ECR.Certificate is not configured")
+	}
+	keys, err := c.ECR.publicKeys()
+	if err != nil {
+		return err
+	}
+	var message snsMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return fmt.Errorf("can't decode SNS message: %s", err)
+	}
+	if c.ECR.TopicArn != "" && message.TopicArn != c.ECR.TopicArn {
+		return fmt.Errorf("unexpected TopicArn %s", message.TopicArn)
+	}
+	// a new certificate can be added next to the old one before AWS rotates it
+	for _, key := range keys {
+		if err = message.verify(key); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (h *SwarmServiceHandler) ecrPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	message := snsMessage{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&message); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookECR, message)
+
+	switch message.Type {
+	case snsTypeSubscriptionConfirmation:
+		if err := confirmSNSSubscription(message.SubscribeURL); err != nil {
+			return result, err
+		}
+		Logz("SNS subscription to %s confirmed", message.TopicArn)
+		result.ignore(message.MessageID, "", "subscription confirmed")
+		return result, nil
+	case snsTypeNotification:
+	default:
+		result.ignore(message.MessageID, "", "message type "+message.Type+" is ignored")
+		return result, nil
+	}
+
+	var event ecrEvent
+	if err := json.Unmarshal([]byte(message.Message), &event); err != nil {
+		return result, fmt.Errorf("can't decode ECR event: %s", err)
+	}
+	var params HookParamsFromPayload
+	if event.Detail.RepositoryName != "" {
+		params.registryImage = fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", event.Account, event.Region, event.Detail.RepositoryName)
+		if event.Detail.ImageTag != "" {
+			params.registryImage += ":" + event.Detail.ImageTag
+		}
+	}
+	switch {
+	case event.DetailType != ecrDetailTypeImageAction:
+		result.ignore(message.MessageID, params.registryImage, "event "+event.DetailType+" is ignored")
+	case event.Detail.ActionType != ecrActionPush:
+		result.ignore(message.MessageID, params.registryImage, "action "+event.Detail.ActionType+" is ignored")
+	case event.Detail.Result != ecrResultSuccess:
+		result.ignore(message.MessageID, params.registryImage, "result "+event.Detail.Result+" is ignored")
+	case event.Detail.ImageTag == "":
+		result.ignore(message.MessageID, params.registryImage, "push without tag")
+	default:
+		params.digest = event.Detail.ImageDigest
+		params.serviceNames = h.config.servicesFor(params.registryImage)
+		result.add(params)
+	}
+	return result, nil
+}
+
+func confirmSNSSubscription(subscribeURL string) error {
+	if subscribeURL == "" {
+		return errors.New("SubscriptionConfirmation without SubscribeURL")
+	}
+	resp, err := snsClient.Get(subscribeURL)
+	if err != nil {
+		return fmt.Errorf("can't confirm SNS subscription: %s", err)
+	}
+	defer withouterrIOClose(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("can't confirm SNS subscription: %s", resp.Status)
+	}
+	return nil
+}
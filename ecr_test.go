@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testSNSTopicArn = "arn:aws:sns:eu-west-1:123456789012:ecr-push"
+	testECREvent    = `{
+  "version": "0",
+  "id": "13cde686-328b-6117-af20-0e5566167482",
+  "detail-type": "ECR Image Action",
+  "source": "aws.ecr",
+  "account": "123456789012",
+  "time": "2019-11-16T01:54:34Z",
+  "region": "eu-west-1",
+  "resources": [],
+  "detail": {
+    "result": "SUCCESS",
+    "repository-name": "app",
+    "image-digest": "sha256:7f5b2640fe6fb4f46592dfd3410c4a79dac4f89e4782432e0378abcd1234abcd",
+    "action-type": "PUSH",
+    "image-tag": "latest"
+  }
+}`
+)
+
+// testRSACertificate - self-signed certificate in place of SNS and Google certificates
+func testRSACertificate(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("can't generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.eu-west-1.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("can't create certificate: %s", err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func testSNSPayload(t *testing.T, key *rsa.PrivateKey, m snsMessage) string {
+	var signature []byte
+	var err error
+	if m.SignatureVersion == "1" {
+		sum := sha1.Sum([]byte(m.stringToSign()))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+	} else {
+		sum := sha256.Sum256([]byte(m.stringToSign()))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	}
+	if err != nil {
+		t.Fatalf("can't sign message: %s", err)
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(signature)
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+func TestECRWebhook(t *testing.T) {
+	key, cert := testRSACertificate(t)
+	config := testConfig
+	config.ECR = ecrConfig{Certificate: cert, TopicArn: testSNSTopicArn}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	confirmed := make(chan string, 1)
+	sns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		confirmed <- r.URL.Query().Get("Token")
+	}))
+	defer sns.Close()
+
+	notification := snsMessage{
+		Type:             snsTypeNotification,
+		MessageID:        "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		TopicArn:         testSNSTopicArn,
+		Message:          testECREvent,
+		Timestamp:        "2019-11-16T01:54:35.000Z",
+		SignatureVersion: "2",
+	}
+	notificationV1 := notification
+	notificationV1.SignatureVersion = "1"
+	subscription := snsMessage{
+		Type:             snsTypeSubscriptionConfirmation,
+		MessageID:        "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		Token:            "2336412f37fb687f5d51e6e241d09c805a5a57b30d712f794cc5f6a988666d92",
+		TopicArn:         testSNSTopicArn,
+		Message:          "You have chosen to subscribe to the topic " + testSNSTopicArn,
+		SubscribeURL:     sns.URL + "/?Action=ConfirmSubscription&Token=2336412f37fb687f5d51e6e241d09c805a5a57b30d712f794cc5f6a988666d92",
+		Timestamp:        "2019-11-16T01:50:00.000Z",
+		SignatureVersion: "2",
+	}
+	tampered := notification
+	tampered.Signature = ""
+	tamperedPayload := testSNSPayload(t, key, tampered)
+	otherTopic := notification
+	otherTopic.TopicArn = "arn:aws:sns:eu-west-1:123456789012:other"
+
+	cases := []Case{
+		{ // case 0
+			Path:    APIEndpointWebHookECR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: testSNSPayload(t, key, notification),
+			Result:  unmappedResult("123456789012.dkr.ecr.eu-west-1.amazonaws.com/app:latest"),
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookECR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: testSNSPayload(t, key, notificationV1),
+			Result:  unmappedResult("123456789012.dkr.ecr.eu-west-1.amazonaws.com/app:latest"),
+		},
+		{ // case 2: signed content is changed
+			Path:    APIEndpointWebHookECR,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: tamperedPayload[:len(tamperedPayload)-1] + `,"Subject":"changed"}`,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookECR,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: testSNSPayload(t, key, otherTopic),
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookECR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: testSNSPayload(t, key, subscription),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"event": subscription.MessageID, "reason": "subscription confirmed"}}},
+		},
+	}
+	runTests(t, ts, cases, config)
+
+	select {
+	case token := <-confirmed:
+		if token != subscription.Token {
+			t.Errorf("expected token %s, got %s", subscription.Token, token)
+		}
+	default:
+		t.Errorf("subscription wasn't confirmed")
+	}
+
+	if _, err := parseConfig([]byte(`{"ECR": {"Certificate": "not a certificate"}}`)); err == nil {
+		t.Errorf("expected error for bad ECR.Certificate")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const gcrActionInsert = "INSERT"
+
+// gcrIssuers - issuers of Google OIDC tokens
+var gcrIssuers = map[string]bool{
+	"https://accounts.google.com": true,
+	"accounts.google.com":         true,
+}
+
+// gcrConfig - Artifact Registry (and Container Registry) notifications of a Pub/Sub push subscription.
+// With PublicKey set the subscription must be authenticated: "Authorization: Bearer <OIDC JWT>"
+// signed by one of the keys (PEM certificates or public keys of Google), else ?key= is checked.
+// Anyone with a Google account can get a token signed by Google, so Audience is required with PublicKey.
+type gcrConfig struct {
+	PublicKey      string
+	Audience       string // "aud" claim, the audience of the push subscription
+	ServiceAccount string // optional, verified "email" claim, the service account of the push subscription
+}
+
+// GCRPayload - Pub/Sub push envelope
+type GCRPayload struct {
+	Message struct {
+		Data      []byte // base64 in json
+		MessageID string `json:"messageId"`
+	}
+	Subscription string
+}
+
+// gcrMessage - Artifact Registry notification, digest and tag are full image references
+type gcrMessage struct {
+	Action string
+	Digest string
+	Tag    string
+}
+
+// jwtClaims - claims of Google OIDC token we check
+type jwtClaims struct {
+	Iss           string
+	Aud           string
+	Email         string
+	EmailVerified bool `json:"email_verified"`
+	Exp           int64
+}
+
+func authorizeGCR(c *mainConfig, r *http.Request, body []byte) error {
+	if c.GCR.PublicKey == "" {
+		// Pub/Sub can't sign the push, ?key= isn't accepted once Signature is enabled
+		if c.Signature.enabled() {
+			return errors.New("GCR.PublicKey is required with Signature")
+		}
+		return authorizeKey(c, r, body)
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return errors.New("missing bearer token")
+	}
+	return c.GCR.verifyToken(token, time.Now())
+}
+
+// verifyToken - checks RS256 signature and claims of JWT, now is a parameter for tests
+func (c *gcrConfig) verifyToken(token string, now time.Time) error {
+	keys, err := rsaPublicKeys(c.PublicKey)
+	if err != nil {
+		return fmt.Errorf("bad GCR.PublicKey: %s", err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	var header struct {
+		Alg string
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return err
+	}
+	if header.Alg != "RS256" {
+		return fmt.Errorf("unsupported alg '%s'", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("bad token signature: %s", err)
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	for _, key := range keys {
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return errors.New("token signature mismatch")
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return err
+	}
+	if !gcrIssuers[claims.Iss] {
+		return fmt.Errorf("unexpected issuer '%s'", claims.Iss)
+	}
+	if now.Unix() >= claims.Exp {
+		return errors.New("token is expired")
+	}
+	if c.Audience == "" || claims.Aud != c.Audience {
+		return fmt.Errorf("unexpected audience '%s'", claims.Aud)
+	}
+	if c.ServiceAccount != "" {
+		if claims.Email != c.ServiceAccount {
+			return fmt.Errorf("unexpected service account '%s'", claims.Email)
+		}
+		if !claims.EmailVerified {
+			return fmt.Errorf("service account '%s' is not verified", claims.Email)
+		}
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("malformed token: %s", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("malformed token: %s", err)
+	}
+	return nil
+}
+
+func (h *SwarmServiceHandler) gcrPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := GCRPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookGCR, payload)
+	if len(payload.Message.Data) == 0 {
+		return result, errors.New("payload without message data")
+	}
+	var message gcrMessage
+	if err := json.Unmarshal(payload.Message.Data, &message); err != nil {
+		return result, fmt.Errorf("can't decode message data: %s", err)
+	}
+	Logz("Pub/Sub message %s: %+v", payload.Message.MessageID, message)
+
+	var params HookParamsFromPayload
+	params.registryImage = message.Tag
+	if message.Action != gcrActionInsert {
+		result.ignore(payload.Message.MessageID, params.registryImage, "action "+message.Action+" is ignored")
+		return result, nil
+	}
+	if message.Tag == "" {
+		result.ignore(payload.Message.MessageID, message.Digest, "push without tag")
+		return result, nil
+	}
+	if i := strings.LastIndex(message.Digest, "@"); i >= 0 {
+		params.digest = message.Digest[i+1:]
+	}
+	params.serviceNames = h.config.servicesFor(params.registryImage)
+	result.add(params)
+	return result, nil
+}
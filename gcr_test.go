@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testGCRAudience = "https://ddw.example.com/webhook/gcr/"
+
+func testGCRPayload(message string) string {
+	data, _ := json.Marshal(CR{
+		"message": CR{
+			"data":        base64.StdEncoding.EncodeToString([]byte(message)),
+			"messageId":   "2070443601311540",
+			"publishTime": "2021-02-26T19:13:55.749Z",
+		},
+		"subscription": "projects/myproject/subscriptions/ddw",
+	})
+	return string(data)
+}
+
+func testJWT(t *testing.T, key *rsa.PrivateKey, claims CR) string {
+	header, _ := json.Marshal(CR{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("can't sign token: %s", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestGCRWebhook(t *testing.T) {
+	key, cert := testRSACertificate(t)
+	config := testConfig
+	config.GCR = gcrConfig{PublicKey: cert, Audience: testGCRAudience}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	claims := CR{"iss": "https://accounts.google.com", "aud": testGCRAudience, "email": "ddw@myproject.iam.gserviceaccount.com", "exp": time.Now().Add(time.Hour).Unix()}
+	bearer := map[string]string{"Authorization": "Bearer " + testJWT(t, key, claims)}
+	insert := testGCRPayload(`{"action": "INSERT", "digest": "europe-docker.pkg.dev/myproject/repo/app@sha256:6ec128e26cd5", "tag": "europe-docker.pkg.dev/myproject/repo/app:1.1"}`)
+	untagged := testGCRPayload(`{"action": "INSERT", "digest": "europe-docker.pkg.dev/myproject/repo/app@sha256:6ec128e26cd5"}`)
+	deleted := testGCRPayload(`{"action": "DELETE", "tag": "europe-docker.pkg.dev/myproject/repo/app:1.1"}`)
+
+	cases := []Case{
+		{ // case 0: ?key= isn't enough when the token is required
+			Path:    APIEndpointWebHookGCR,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: insert,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookGCR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: insert,
+			Headers: bearer,
+			Result:  unmappedResult("europe-docker.pkg.dev/myproject/repo/app:1.1"),
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookGCR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: untagged,
+			Headers: bearer,
+			Result: CR{"error": "nothing to deploy", "ignored": []CR{{
+				"event": "2070443601311540", "image": "europe-docker.pkg.dev/myproject/repo/app@sha256:6ec128e26cd5", "reason": "push without tag",
+			}}},
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookGCR,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: deleted,
+			Headers: bearer,
+			Result: CR{"error": "nothing to deploy", "ignored": []CR{{
+				"event": "2070443601311540", "image": "europe-docker.pkg.dev/myproject/repo/app:1.1", "reason": "action DELETE is ignored",
+			}}},
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookGCR,
+			Method:  http.MethodPost,
+			Status:  http.StatusBadRequest,
+			Payload: `{"message": {}}`,
+			Headers: bearer,
+			Result:  CR{"error": "can't decode payload: payload without message data"},
+		},
+	}
+	runTests(t, ts, cases, config)
+
+	// without PublicKey the push endpoint URL carries ?key=
+	config.GCR = gcrConfig{}
+	ts = httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	keyCase := cases[0]
+	keyCase.Status = http.StatusOK
+	keyCase.Result = unmappedResult("europe-docker.pkg.dev/myproject/repo/app:1.1")
+	runTests(t, ts, []Case{keyCase}, config)
+
+	// ?key= isn't accepted once Signature is enabled, an empty key is never accepted
+	forbidden := cases[0]
+	forbidden.Status = http.StatusForbidden
+	forbidden.Result = CR{"error": "unauthorized"}
+	signedConfig := config
+	signedConfig.Signature = signatureConfig{Secret: testSignatureSecret}
+	ts = httptest.NewServer(&SwarmServiceHandler{signedConfig, testUpdateOpts})
+	runTests(t, ts, []Case{forbidden}, signedConfig)
+	signedConfig.APISecretKey = ""
+	forbidden.Query = APIWebHookKeyName + "="
+	ts = httptest.NewServer(&SwarmServiceHandler{signedConfig, testUpdateOpts})
+	runTests(t, ts, []Case{forbidden}, signedConfig)
+}
+
+func TestGCRVerifyToken(t *testing.T) {
+	key, cert := testRSACertificate(t)
+	otherKey, _ := testRSACertificate(t)
+	now := time.Unix(1614366835, 0)
+	config := gcrConfig{PublicKey: cert, Audience: testGCRAudience, ServiceAccount: "ddw@myproject.iam.gserviceaccount.com"}
+	claims := func(change CR) CR {
+		c := CR{"iss": "accounts.google.com", "aud": testGCRAudience, "email": "ddw@myproject.iam.gserviceaccount.com", "email_verified": true, "exp": now.Add(time.Hour).Unix()}
+		for k, v := range change {
+			c[k] = v
+		}
+		return c
+	}
+
+	cases := []struct {
+		token string
+		ok    bool
+	}{
+		{testJWT(t, key, claims(nil)), true},
+		{testJWT(t, otherKey, claims(nil)), false},
+		{testJWT(t, key, claims(CR{"iss": "https://evil.example.com"})), false},
+		{testJWT(t, key, claims(CR{"aud": "https://other.example.com"})), false},
+		{testJWT(t, key, claims(CR{"email": "other@myproject.iam.gserviceaccount.com"})), false},
+		{testJWT(t, key, claims(CR{"email_verified": false})), false},
+		{testJWT(t, key, claims(CR{"aud": ""})), false},
+		{testJWT(t, key, claims(CR{"exp": now.Add(-time.Second).Unix()})), false},
+		{"not.a.token", false},
+		{"", false},
+	}
+	for idx, c := range cases {
+		err := config.verifyToken(c.token, now)
+		if c.ok != (err == nil) {
+			t.Errorf("case %d: expected ok=%v, got error: %v", idx, c.ok, err)
+		}
+	}
+
+	// any Google account can get a token of accounts.google.com, only the audience tells them apart
+	noAudience := gcrConfig{PublicKey: cert}
+	if err := noAudience.verifyToken(testJWT(t, key, claims(CR{"aud": ""})), now); err == nil {
+		t.Errorf("expected error without Audience")
+	}
+	raw, _ := json.Marshal(CR{"GCR": noAudience})
+	if _, err := parseConfig(raw); err == nil {
+		t.Errorf("expected validation error for PublicKey without Audience")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// genericSource - webhook of /webhook/generic/{name}/ described by expressions instead of code.
+// Every expression is a JSONPath-style path ("$.repository.name", "$.tags[0]"),
+// a Go template ("{{.repository.namespace}}/{{.repository.name}}") or a constant.
+// The image is Host/Repository:Tag with optional Digest.
+type genericSource struct {
+	Events     string // optional path to the array of events, e.g. "$.events", else the payload is one event
+	Filter     string // optional, the event is deployed only if it evaluates to "true"
+	Host       string // optional
+	Repository string
+	Tag        string
+	Digest     string          // optional
+	Signature  signatureConfig // optional, HMAC of the payload instead of ?key= and global Signature
+
+	compiled *genericSourceExpressions // set by validateGeneric
+}
+
+var genericFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimPrefix": strings.TrimPrefix,
+	"trimSuffix": strings.TrimSuffix,
+	"replace":    strings.Replace,
+}
+
+// genericExpression - compiled expression of genericSource
+type genericExpression struct {
+	isPath   bool
+	path     jsonPath
+	template *template.Template
+	constant string
+}
+
+func compileGenericExpression(expr string) (*genericExpression, error) {
+	switch {
+	case strings.HasPrefix(expr, "$"):
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		return &genericExpression{isPath: true, path: path}, nil
+	case strings.Contains(expr, "{{"):
+		tmpl, err := template.New("").Funcs(genericFuncs).Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		return &genericExpression{template: tmpl}, nil
+	}
+	return &genericExpression{constant: expr}, nil
+}
+
+// eval - string value of the expression, missing values are empty
+func (e *genericExpression) eval(data interface{}) (string, error) {
+	if e.template != nil {
+		var out bytes.Buffer
+		if err := e.template.Execute(&out, data); err != nil {
+			return "", err
+		}
+		return strings.Replace(out.String(), "<no value>", "", -1), nil
+	}
+	if !e.isPath {
+		return e.constant, nil
+	}
+	switch value := e.path.value(data).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	default:
+		return "", errors.New("value is not a string")
+	}
+}
+
+// genericSourceExpressions - compiled expressions, empty ones are nil
+type genericSourceExpressions struct {
+	events, filter, host, repository, tag, digest *genericExpression
+}
+
+func (s *genericSource) compile() (*genericSourceExpressions, error) {
+	if s.Repository == "" {
+		return nil, errors.New("empty Repository")
+	}
+	if s.Tag == "" {
+		return nil, errors.New("empty Tag")
+	}
+	if s.Events != "" && !strings.HasPrefix(s.Events, "$") {
+		return nil, errors.New("Events must be a path")
+	}
+	var compiled genericSourceExpressions
+	fields := []struct {
+		name string
+		expr string
+		dst  **genericExpression
+	}{
+		{"Events", s.Events, &compiled.events},
+		{"Filter", s.Filter, &compiled.filter},
+		{"Host", s.Host, &compiled.host},
+		{"Repository", s.Repository, &compiled.repository},
+		{"Tag", s.Tag, &compiled.tag},
+		{"Digest", s.Digest, &compiled.digest},
+	}
+	for _, field := range fields {
+		if field.expr == "" {
+			continue
+		}
+		expr, err := compileGenericExpression(field.expr)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s: %s", field.name, err)
+		}
+		*field.dst = expr
+	}
+	return &compiled, nil
+}
+
+func (c *mainConfig) validateGeneric() error {
+	for name, source := range c.Generic {
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("bad Generic source name '%s'", name)
+		}
+		compiled, err := source.compile()
+		if err != nil {
+			return fmt.Errorf("bad Generic source '%s': %s", name, err)
+		}
+		source.compiled = compiled
+		c.Generic[name] = source
+	}
+	return nil
+}
+
+// genericWebhookSource - source of /webhook/generic/{name}/ if the name is configured
+func (c *mainConfig) genericWebhookSource(path string) (webhookSource, bool) {
+	name := strings.TrimSuffix(strings.TrimPrefix(path, APIEndpointWebHookGeneric), "/")
+	source, ok := c.Generic[name]
+	if !ok || !strings.HasPrefix(path, APIEndpointWebHookGeneric) {
+		return webhookSource{}, false
+	}
+	parse := func(h *SwarmServiceHandler, header http.Header, body io.Reader) (hookPayload, error) {
+		return h.genericPayload(name, source, body)
+	}
+	if !source.Signature.enabled() {
+		return webhookSource{parse, nil}, true
+	}
+	authorize := func(c *mainConfig, r *http.Request, body []byte) error {
+		return source.Signature.verify(r.Header, body, time.Now())
+	}
+	return webhookSource{parse, authorize}, true
+}
+
+func (h *SwarmServiceHandler) genericPayload(name string, source genericSource, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	exprs := source.compiled
+	if exprs == nil {
+		return result, fmt.Errorf("Generic source '%s' is not validated", name)
+	}
+	var payload interface{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s%s/: %+v", APIEndpointWebHookGeneric, name, payload)
+
+	events := []interface{}{payload}
+	if exprs.events != nil {
+		var ok bool
+		if events, ok = exprs.events.path.value(payload).([]interface{}); !ok {
+			return result, fmt.Errorf("no events at %s", source.Events)
+		}
+	}
+	for i, event := range events {
+		params, reason := exprs.params(event)
+		if reason != "" {
+			var id string
+			if exprs.events != nil {
+				id = strconv.Itoa(i)
+			}
+			result.ignore(id, params.registryImage, reason)
+			continue
+		}
+		params.serviceNames = h.config.servicesFor(params.registryImage)
+		result.add(params)
+	}
+	return result, nil
+}
+
+// params - image of the event or the reason why it's not deployable
+func (e *genericSourceExpressions) params(event interface{}) (HookParamsFromPayload, string) {
+	var params HookParamsFromPayload
+	values := map[string]string{}
+	fields := []struct {
+		name string
+		expr *genericExpression
+	}{
+		{"Filter", e.filter},
+		{"Host", e.host},
+		{"Repository", e.repository},
+		{"Tag", e.tag},
+		{"Digest", e.digest},
+	}
+	for _, field := range fields {
+		if field.expr == nil {
+			continue
+		}
+		value, err := field.expr.eval(event)
+		if err != nil {
+			return params, fmt.Sprintf("%s: %s", field.name, err)
+		}
+		values[field.name] = strings.TrimSpace(value)
+	}
+
+	params.registryImage = values["Repository"]
+	if values["Host"] != "" && params.registryImage != "" {
+		params.registryImage = values["Host"] + "/" + params.registryImage
+	}
+	if values["Tag"] != "" {
+		params.registryImage += ":" + values["Tag"]
+	}
+	switch {
+	case e.filter != nil && values["Filter"] != "true":
+		return params, "filtered out"
+	case values["Repository"] == "":
+		return params, "no repository"
+	case values["Tag"] == "":
+		return params, "push without tag"
+	}
+	params.digest = values["Digest"]
+	return params, ""
+}
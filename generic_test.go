@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenericWebhook(t *testing.T) {
+	config := testConfig
+	config.Generic = map[string]genericSource{
+		"ci": {
+			Filter:     `{{eq .status "success"}}`,
+			Host:       "registry.example.com",
+			Repository: "$.image.name",
+			Tag:        "$.image.tags[0]",
+			Digest:     "$.image.digest",
+		},
+		"signed": {
+			Repository: "{{.project}}/{{lower .app}}",
+			Tag:        "$.version",
+			Signature:  signatureConfig{Secret: testSignatureSecret},
+		},
+	}
+	if err := config.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	query := fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey)
+	payloadCI := `{"status": "success", "image": {"name": "vorona/app", "tags": ["1.4.0", "latest"], "digest": "sha256:0123"}}`
+	payloadFailed := `{"status": "failed", "image": {"name": "vorona/app", "tags": ["1.4.0"]}}`
+	payloadSigned := `{"project": "vorona", "app": "App", "version": 15}`
+
+	cases := []Case{
+		{ // case 0
+			Path:    APIEndpointWebHookGeneric + "ci/",
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: payloadCI,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookGeneric + "ci/",
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusOK,
+			Payload: payloadCI,
+			Result:  unmappedResult("registry.example.com/vorona/app:1.4.0"),
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookGeneric + "ci/",
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusOK,
+			Payload: payloadFailed,
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "registry.example.com/vorona/app:1.4.0", "reason": "filtered out"}}},
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookGeneric + "unknown/",
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusBadRequest,
+			Payload: payloadCI,
+			Result:  CR{"error": "bad endpoint"},
+		},
+		{ // case 4: the source signature replaces ?key=
+			Path:    APIEndpointWebHookGeneric + "signed/",
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusForbidden,
+			Payload: payloadSigned,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 5
+			Path:    APIEndpointWebHookGeneric + "signed/",
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadSigned,
+			Headers: map[string]string{defaultSignatureHeader: testSignature(testSignatureSecret, payloadSigned)},
+			Result:  unmappedResult("vorona/app:15"),
+		},
+	}
+	runTests(t, ts, cases, config)
+}
+
+func TestGenericPayloadEvents(t *testing.T) {
+	config := testConfig
+	config.Services = map[string]serviceList{"vorona/app:latest": {"app"}}
+	config.Generic = map[string]genericSource{"batch": {
+		Events:     "$.pushes",
+		Filter:     "$.ok",
+		Repository: "$.repo",
+		Tag:        "$.tag",
+	}}
+	if err := config.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+	payload := `{"pushes": [
+		{"ok": true, "repo": "vorona/app", "tag": "latest"},
+		{"ok": false, "repo": "vorona/app", "tag": "next"},
+		{"ok": true, "repo": "vorona/app"},
+		{"ok": true, "repo": {"name": "vorona/app"}, "tag": "latest"}
+	]}`
+
+	result, err := h.getHookParamsFromPayload(strings.NewReader(payload), APIEndpointWebHookGeneric+"batch/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedTargets := []HookParamsFromPayload{{"vorona/app:latest", "", []string{"app"}}}
+	if !reflect.DeepEqual(result.targets, expectedTargets) {
+		t.Errorf("expected targets %+v, got %+v", expectedTargets, result.targets)
+	}
+	expectedIgnored := []ignoredEvent{
+		{"1", "vorona/app:next", "filtered out"},
+		{"2", "vorona/app", "push without tag"},
+		{"3", "", "Repository: value is not a string"},
+	}
+	if !reflect.DeepEqual(result.ignored, expectedIgnored) {
+		t.Errorf("expected ignored %+v, got %+v", expectedIgnored, result.ignored)
+	}
+
+	if _, err := h.getHookParamsFromPayload(strings.NewReader(`{"pushes": {}}`), APIEndpointWebHookGeneric+"batch/", nil); err == nil {
+		t.Errorf("expected error for payload without events")
+	}
+}
+
+func TestGenericSourceValidate(t *testing.T) {
+	bad := []string{
+		`{"Generic": {"ci": {"Tag": "$.tag"}}}`,
+		`{"Generic": {"ci": {"Repository": "$.repo"}}}`,
+		`{"Generic": {"ci": {"Repository": "$.repo[", "Tag": "$.tag"}}}`,
+		`{"Generic": {"ci": {"Repository": "$..repo", "Tag": "$.tag"}}}`,
+		`{"Generic": {"ci": {"Repository": "{{.repo", "Tag": "$.tag"}}}`,
+		`{"Generic": {"ci": {"Events": "events", "Repository": "$.repo", "Tag": "$.tag"}}}`,
+		`{"Generic": {"c/i": {"Repository": "$.repo", "Tag": "$.tag"}}}`,
+	}
+	for _, raw := range bad {
+		if _, err := parseConfig([]byte(raw)); err == nil {
+			t.Errorf("expected error for config: %s", raw)
+		}
+	}
+	if _, err := parseConfig([]byte(`{"Generic": {"ci": {"Host": "registry.example.com", "Repository": "$.repo", "Tag": "latest"}}}`)); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
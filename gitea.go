@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	giteaSignatureHeader   = "X-Gitea-Signature"
+	forgejoSignatureHeader = "X-Forgejo-Signature"
+	giteaActionCreated     = "created"
+	giteaContainerPackage  = "container"
+)
+
+// giteaConfig - Gitea and Forgejo package webhook, Secret is the secret of the webhook
+type giteaConfig struct {
+	Secret   string
+	Registry string // host of the container registry, default host of the package html_url
+}
+
+// GiteaPayload - payload of Gitea/Forgejo "package" webhook event
+type GiteaPayload struct {
+	Action  string
+	Package *struct {
+		Type    string
+		Name    string
+		Version string
+		HTMLURL string `json:"html_url"`
+		Owner   struct {
+			Login string
+		}
+	}
+}
+
+// authorizeGitea - hex HMAC-SHA256 of the payload, Forgejo sends the same in X-Forgejo-Signature
+func authorizeGitea(c *mainConfig, r *http.Request, body []byte) error {
+	if c.Gitea.Secret == "" {
+		return errors.New("Gitea.Secret is not configured")
+	}
+	header := giteaSignatureHeader
+	if r.Header.Get(forgejoSignatureHeader) != "" {
+		header = forgejoSignatureHeader
+	}
+	signature := signatureConfig{Secret: c.Gitea.Secret, Header: header}
+	return signature.verify(r.Header, body, time.Now())
+}
+
+func (h *SwarmServiceHandler) giteaPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := GiteaPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookGitea, payload)
+	pkg := payload.Package
+	if pkg == nil {
+		return result, errors.New("payload without package")
+	}
+
+	registry := h.config.Gitea.Registry
+	if registry == "" {
+		htmlURL, err := url.Parse(pkg.HTMLURL)
+		if err != nil || htmlURL.Host == "" {
+			return result, errors.New("can't get registry host from html_url, set Gitea.Registry")
+		}
+		registry = htmlURL.Host
+	}
+	// Gitea stores container names in lower case
+	var params HookParamsFromPayload
+	params.registryImage = registry + "/" + strings.ToLower(pkg.Owner.Login+"/"+pkg.Name)
+	if pkg.Version != "" && !strings.HasPrefix(pkg.Version, "sha256:") {
+		params.registryImage += ":" + pkg.Version
+	}
+	if payload.Action != giteaActionCreated {
+		result.ignore("", params.registryImage, "action "+payload.Action+" is ignored")
+		return result, nil
+	}
+	if pkg.Type != giteaContainerPackage {
+		result.ignore("", params.registryImage, "package type "+pkg.Type+" is not deployable")
+		return result, nil
+	}
+	if pkg.Version == "" || strings.HasPrefix(pkg.Version, "sha256:") {
+		// untagged manifest, e.g. a platform manifest of a multi-arch image
+		result.ignore("", params.registryImage, "push without tag")
+		return result, nil
+	}
+	params.serviceNames = h.config.servicesFor(params.registryImage)
+	result.add(params)
+	return result, nil
+}
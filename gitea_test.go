@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testGiteaSecret     = "Oor4quaeShei9wai"
+	payloadGiteaPackage = `{
+  "action": "created",
+  "package": {
+    "id": 42,
+    "owner": {"id": 1, "login": "Vorona", "username": "Vorona"},
+    "repository": null,
+    "creator": {"id": 1, "login": "Vorona"},
+    "type": "container",
+    "name": "app",
+    "version": "1.4.0",
+    "created_at": "2023-05-04T10:00:00Z",
+    "html_url": "https://gitea.example.com/Vorona/-/packages/container/app/1.4.0"
+  },
+  "sender": {"id": 1, "login": "Vorona"}
+}`
+)
+
+func TestGiteaWebhook(t *testing.T) {
+	config := testConfig
+	config.Gitea = giteaConfig{Secret: testGiteaSecret}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	signed := func(header, payload string) map[string]string {
+		return map[string]string{header: testSignature(testGiteaSecret, payload)}
+	}
+	payloadUntagged := `{"action": "created", "package": {"type": "container", "name": "app", "version": "sha256:0123", "owner": {"login": "vorona"}, "html_url": "https://gitea.example.com/vorona/-/packages/container/app/sha256:0123"}}`
+	payloadNpm := `{"action": "created", "package": {"type": "npm", "name": "app", "version": "1.4.0", "owner": {"login": "vorona"}, "html_url": "https://gitea.example.com/vorona/-/packages/npm/app/1.4.0"}}`
+	payloadDeleted := `{"action": "deleted", "package": {"type": "container", "name": "app", "version": "1.4.0", "owner": {"login": "vorona"}, "html_url": "https://gitea.example.com/vorona/-/packages/container/app/1.4.0"}}`
+
+	cases := []Case{
+		{ // case 0: ?key= isn't accepted
+			Path:    APIEndpointWebHookGitea,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadGiteaPackage,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookGitea,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadGiteaPackage,
+			Headers: signed(giteaSignatureHeader, payloadGiteaPackage),
+			Result:  unmappedResult("gitea.example.com/vorona/app:1.4.0"),
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookGitea,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadGiteaPackage,
+			Headers: signed(forgejoSignatureHeader, payloadGiteaPackage),
+			Result:  unmappedResult("gitea.example.com/vorona/app:1.4.0"),
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookGitea,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadUntagged,
+			Headers: signed(giteaSignatureHeader, payloadUntagged),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "gitea.example.com/vorona/app", "reason": "push without tag"}}},
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookGitea,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadNpm,
+			Headers: signed(giteaSignatureHeader, payloadNpm),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "gitea.example.com/vorona/app:1.4.0", "reason": "package type npm is not deployable"}}},
+		},
+		{ // case 5
+			Path:    APIEndpointWebHookGitea,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadDeleted,
+			Headers: signed(giteaSignatureHeader, payloadDeleted),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "gitea.example.com/vorona/app:1.4.0", "reason": "action deleted is ignored"}}},
+		},
+		{ // case 6
+			Path:    APIEndpointWebHookGitea,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: payloadGiteaPackage,
+			Headers: map[string]string{giteaSignatureHeader: testSignature("wrong", payloadGiteaPackage)},
+			Result:  CR{"error": "unauthorized"},
+		},
+	}
+	runTests(t, ts, cases, config)
+}
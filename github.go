@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	gitHubSignatureHeader  = "X-Hub-Signature-256"
+	defaultGitHubRegistry  = "ghcr.io"
+	gitHubActionPublished  = "published"
+	gitHubContainerPackage = "container"
+)
+
+// gitHubConfig - GitHub Packages webhook, Secret is the secret of the webhook in GitHub settings
+type gitHubConfig struct {
+	Secret   string
+	Registry string // default ghcr.io
+}
+
+func (c *gitHubConfig) registry() string {
+	if c.Registry == "" {
+		return defaultGitHubRegistry
+	}
+	return c.Registry
+}
+
+// gitHubPackage - package of "package" and "registry_package" events
+type gitHubPackage struct {
+	Name        string
+	Namespace   string
+	PackageType string `json:"package_type"`
+	Owner       struct {
+		Login string
+	}
+	PackageVersion struct {
+		Version           string
+		ContainerMetadata struct {
+			Tag struct {
+				Name   string
+				Digest string
+			}
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+// GitHubPayload - payload of GitHub "package" and "registry_package" webhook events
+type GitHubPayload struct {
+	Zen             string // ping event
+	Action          string
+	Package         *gitHubPackage
+	RegistryPackage *gitHubPackage `json:"registry_package"`
+}
+
+func authorizeGitHub(c *mainConfig, r *http.Request, body []byte) error {
+	if c.GitHub.Secret == "" {
+		return errors.New("GitHub.Secret is not configured")
+	}
+	signature := signatureConfig{Secret: c.GitHub.Secret, Header: gitHubSignatureHeader}
+	return signature.verify(r.Header, body, time.Now())
+}
+
+func (h *SwarmServiceHandler) gitHubPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := GitHubPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookGitHub, payload)
+	if payload.Zen != "" {
+		result.ignore("", "", "ping event")
+		return result, nil
+	}
+	pkg := payload.Package
+	if pkg == nil {
+		pkg = payload.RegistryPackage
+	}
+	if pkg == nil {
+		return result, errors.New("payload without package")
+	}
+
+	params, reason := h.config.gitHubPackageParams(payload.Action, pkg)
+	if reason != "" {
+		result.ignore("", params.registryImage, reason)
+		return result, nil
+	}
+	params.serviceNames = h.config.servicesFor(params.registryImage)
+	result.add(params)
+	return result, nil
+}
+
+// gitHubPackageParams - image of the published container version or the reason why it's not deployable.
+// ghcr.io stores owner and package names in lower case.
+func (c *mainConfig) gitHubPackageParams(action string, pkg *gitHubPackage) (HookParamsFromPayload, string) {
+	var params HookParamsFromPayload
+	owner := pkg.Namespace
+	if owner == "" {
+		owner = pkg.Owner.Login
+	}
+	tag := pkg.PackageVersion.ContainerMetadata.Tag
+	params.registryImage = c.GitHub.registry() + "/" + strings.ToLower(owner+"/"+pkg.Name)
+	if tag.Name != "" {
+		params.registryImage += ":" + tag.Name
+	}
+	if action != gitHubActionPublished {
+		return params, "action " + action + " is ignored"
+	}
+	if !strings.EqualFold(pkg.PackageType, gitHubContainerPackage) {
+		return params, "package type " + pkg.PackageType + " is not deployable"
+	}
+	if tag.Name == "" {
+		return params, "push without tag"
+	}
+	params.digest = tag.Digest
+	if params.digest == "" && strings.HasPrefix(pkg.PackageVersion.Version, "sha256:") {
+		params.digest = pkg.PackageVersion.Version
+	}
+	return params, ""
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testGitHubSecret     = "Ieth6yaiquaeWoh4"
+	payloadGitHubPackage = `{
+  "action": "published",
+  "package": {
+    "id": 1234567,
+    "name": "App",
+    "namespace": "Vorona",
+    "package_type": "CONTAINER",
+    "owner": {"login": "Vorona"},
+    "package_version": {
+      "id": 7654321,
+      "version": "sha256:5c4b17e4b4f3a4b1e3dd4b07c6d3c9a6d41a4bd0c7b1d5c9f1a1e8e6f7a8b9c0",
+      "name": "sha256:5c4b17e4b4f3a4b1e3dd4b07c6d3c9a6d41a4bd0c7b1d5c9f1a1e8e6f7a8b9c0",
+      "container_metadata": {
+        "tag": {"name": "v1.2.0", "digest": "sha256:5c4b17e4b4f3a4b1e3dd4b07c6d3c9a6d41a4bd0c7b1d5c9f1a1e8e6f7a8b9c0"}
+      },
+      "package_url": "ghcr.io/vorona/app:v1.2.0"
+    },
+    "registry": {"url": "https://ghcr.io/vorona", "type": "docker"}
+  }
+}`
+)
+
+func TestGitHubWebhook(t *testing.T) {
+	config := testConfig
+	config.GitHub = gitHubConfig{Secret: testGitHubSecret}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	signed := func(payload string) map[string]string {
+		return map[string]string{gitHubSignatureHeader: "sha256=" + testSignature(testGitHubSecret, payload)}
+	}
+	payloadPing := `{"zen": "Design for failure.", "hook_id": 1}`
+	payloadUpdated := `{"action": "updated", "registry_package": {"name": "app", "namespace": "vorona", "package_type": "CONTAINER"}}`
+
+	cases := []Case{
+		{ // case 0: ?key= isn't accepted
+			Path:    APIEndpointWebHookGitHub,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadGitHubPackage,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookGitHub,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: payloadGitHubPackage,
+			Headers: map[string]string{gitHubSignatureHeader: "sha256=" + testSignature("wrong", payloadGitHubPackage)},
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookGitHub,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadPing,
+			Headers: signed(payloadPing),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"reason": "ping event"}}},
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookGitHub,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadGitHubPackage,
+			Headers: signed(payloadGitHubPackage),
+			Result:  unmappedResult("ghcr.io/vorona/app:v1.2.0"),
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookGitHub,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadUpdated,
+			Headers: signed(payloadUpdated),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "ghcr.io/vorona/app", "reason": "action updated is ignored"}}},
+		},
+		{ // case 5
+			Path:    APIEndpointWebHookGitHub,
+			Method:  http.MethodPost,
+			Status:  http.StatusBadRequest,
+			Payload: `{}`,
+			Headers: signed(`{}`),
+			Result:  CR{"error": "can't decode payload: payload without package"},
+		},
+	}
+	runTests(t, ts, cases, config)
+
+	// the endpoint is closed until the secret is configured
+	config.GitHub = gitHubConfig{}
+	ts = httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	closed := cases[3]
+	closed.Status = http.StatusForbidden
+	closed.Result = CR{"error": "unauthorized"}
+	runTests(t, ts, []Case{closed}, config)
+}
+
+func TestGitHubPackageParams(t *testing.T) {
+	config := mainConfig{GitHub: gitHubConfig{Registry: "ghcr.example.com"}}
+	pkg := &gitHubPackage{Name: "app", Namespace: "vorona", PackageType: "container"}
+	pkg.PackageVersion.Version = "sha256:0123"
+	pkg.PackageVersion.ContainerMetadata.Tag.Name = "latest"
+
+	params, reason := config.gitHubPackageParams(gitHubActionPublished, pkg)
+	if reason != "" || params.registryImage != "ghcr.example.com/vorona/app:latest" || params.digest != "sha256:0123" {
+		t.Errorf("unexpected params %+v, reason %q", params, reason)
+	}
+
+	pkg.PackageType = "npm"
+	if _, reason := config.gitHubPackageParams(gitHubActionPublished, pkg); reason != "package type npm is not deployable" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+
+	pkg.PackageType = "container"
+	pkg.PackageVersion.ContainerMetadata.Tag.Name = ""
+	if _, reason := config.gitHubPackageParams(gitHubActionPublished, pkg); reason != "push without tag" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/docker/distribution/notifications"
+	"io"
+	"net/http"
+)
+
+const gitLabTokenHeader = "X-Gitlab-Token"
+
+// gitLabConfig - GitLab container registry notifications.
+// GitLab registry is docker distribution, it sends the same event envelope as the registry,
+// the endpoint is added to gitlab.rb registry['notifications'] with the X-Gitlab-Token header.
+type gitLabConfig struct {
+	Token    string
+	Registry string // host of the images, e.g. registry.gitlab.example.com, if events carry an internal host
+}
+
+// GitLabPayload - registry notification envelope, object_kind is set in GitLab test hooks
+type GitLabPayload struct {
+	ObjectKind string `json:"object_kind"`
+	Events     []notifications.Event
+}
+
+func authorizeGitLab(c *mainConfig, r *http.Request, body []byte) error {
+	if c.GitLab.Token == "" {
+		return errors.New("GitLab.Token is not configured")
+	}
+	return headerTokenMatches(r, gitLabTokenHeader, c.GitLab.Token)
+}
+
+func (h *SwarmServiceHandler) gitLabPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := GitLabPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookGitLab, payload)
+	if payload.ObjectKind != "" {
+		result.ignore("", "", "object_kind "+payload.ObjectKind+" is ignored")
+		return result, nil
+	}
+	if len(payload.Events) == 0 {
+		return result, errors.New("payload without events")
+	}
+	if h.config.GitLab.Registry != "" {
+		for i := range payload.Events {
+			payload.Events[i].Request.Host = h.config.GitLab.Registry
+		}
+	}
+	h.addRegistryEvents(&result, payload.Events)
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testGitLabToken = "Xoo3aighoh5ooPhe"
+
+func TestGitLabWebhook(t *testing.T) {
+	config := testConfig
+	config.GitLab = gitLabConfig{Token: testGitLabToken, Registry: "registry.gitlab.example.com"}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	token := map[string]string{gitLabTokenHeader: testGitLabToken}
+
+	cases := []Case{
+		{ // case 0: ?key= isn't accepted
+			Path:    APIEndpointWebHookGitLab,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadDockerService,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookGitLab,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: payloadDockerService,
+			Headers: map[string]string{gitLabTokenHeader: "wrong"},
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 2: "Test" button of the GitLab webhook
+			Path:    APIEndpointWebHookGitLab,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: `{"object_kind": "push", "ref": "refs/heads/master"}`,
+			Headers: token,
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"reason": "object_kind push is ignored"}}},
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookGitLab,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadDockerService,
+			Headers: token,
+			Result:  unmappedResult("registry.gitlab.example.com/projectq-app:latest"),
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookGitLab,
+			Method:  http.MethodPost,
+			Status:  http.StatusBadRequest,
+			Payload: `{"events": []}`,
+			Headers: token,
+			Result:  CR{"error": "can't decode payload: payload without events"},
+		},
+	}
+	runTests(t, ts, cases, config)
+
+	// events keep their own host without GitLab.Registry
+	config.GitLab.Registry = ""
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(payloadDockerService), APIEndpointWebHookGitLab, nil)
+	if err != nil || len(payload.targets) != 1 || payload.targets[0].serviceNames[0] != "projectq-stack-latest_backend" {
+		t.Errorf("unexpected payload %+v, error: %v", payload, err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const harborEventPushArtifact = "PUSH_ARTIFACT"
+
+// harborConfig - Harbor webhook, Authorization is the "Auth Header" of the webhook policy in Harbor
+type harborConfig struct {
+	Authorization string
+}
+
+// harborResource - pushed artifact, resource_url is host/project/repository:tag
+type harborResource struct {
+	Digest      string
+	Tag         string
+	ResourceURL string `json:"resource_url"`
+}
+
+// HarborPayload - payload of Harbor 2.x webhook
+type HarborPayload struct {
+	Type      string
+	EventData struct {
+		Resources  []harborResource
+		Repository struct {
+			Name         string
+			Namespace    string
+			RepoFullName string `json:"repo_full_name"`
+		}
+	} `json:"event_data"`
+}
+
+func authorizeHarbor(c *mainConfig, r *http.Request, body []byte) error {
+	if c.Harbor.Authorization == "" {
+		return errors.New("Harbor.Authorization is not configured")
+	}
+	return headerTokenMatches(r, "Authorization", c.Harbor.Authorization)
+}
+
+func (h *SwarmServiceHandler) harborPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := HarborPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookHarbor, payload)
+	if payload.Type != harborEventPushArtifact {
+		result.ignore("", "", "event type "+payload.Type+" is ignored")
+		return result, nil
+	}
+	if len(payload.EventData.Resources) == 0 {
+		return result, errors.New("payload without resources")
+	}
+
+	repository := payload.EventData.Repository.RepoFullName
+	if repository == "" {
+		repository = payload.EventData.Repository.Namespace + "/" + payload.EventData.Repository.Name
+	}
+	for _, resource := range payload.EventData.Resources {
+		var params HookParamsFromPayload
+		params.registryImage = resource.ResourceURL
+		if resource.ResourceURL == "" {
+			result.ignore("", "", "resource without resource_url")
+			continue
+		}
+		if resource.Tag == "" {
+			result.ignore("", params.registryImage, "push without tag")
+			continue
+		}
+		params.digest = resource.Digest
+		params.serviceNames = h.config.servicesFor(params.registryImage)
+		if len(params.serviceNames) == 0 {
+			// project/repository:tag, so mappings don't depend on the Harbor host
+			params.serviceNames = h.config.servicesFor(repository + ":" + resource.Tag)
+		}
+		result.add(params)
+	}
+	return result, nil
+}
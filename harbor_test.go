@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testHarborAuthorization = "Bearer eiZ9ahth7Ieweiqu"
+	payloadHarborPush       = `{
+  "type": "PUSH_ARTIFACT",
+  "occur_at": 1680000000,
+  "operator": "robot$ci",
+  "event_data": {
+    "resources": [
+      {"digest": "sha256:0123", "tag": "v1", "resource_url": "harbor.example.com/library/app:v1"},
+      {"digest": "sha256:4567", "tag": "v2", "resource_url": "harbor.example.com/library/app:v2"},
+      {"digest": "sha256:89ab", "resource_url": "harbor.example.com/library/app@sha256:89ab"}
+    ],
+    "repository": {"date_created": 1680000000, "name": "app", "namespace": "library", "repo_full_name": "library/app", "repo_type": "private"}
+  }
+}`
+)
+
+func TestHarborWebhook(t *testing.T) {
+	config := testConfig
+	config.Harbor = harborConfig{Authorization: testHarborAuthorization}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	cases := []Case{
+		{ // case 0: ?key= isn't accepted
+			Path:    APIEndpointWebHookHarbor,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadHarborPush,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookHarbor,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: `{"type": "PULL_ARTIFACT", "event_data": {}}`,
+			Headers: map[string]string{"Authorization": testHarborAuthorization},
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"reason": "event type PULL_ARTIFACT is ignored"}}},
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookHarbor,
+			Method:  http.MethodPost,
+			Status:  http.StatusBadRequest,
+			Payload: `{"type": "PUSH_ARTIFACT", "event_data": {}}`,
+			Headers: map[string]string{"Authorization": testHarborAuthorization},
+			Result:  CR{"error": "can't decode payload: payload without resources"},
+		},
+	}
+	runTests(t, ts, cases, config)
+}
+
+func TestHarborPayloadMappings(t *testing.T) {
+	config := testConfig
+	config.Services = map[string]serviceList{"harbor.example.com/library/app:v1": {"app_v1"}}
+	config.Rules = []mappingRule{{Image: "library/app:*", Service: serviceList{"app_any"}}}
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(payloadHarborPush), APIEndpointWebHookHarbor, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedTargets := []HookParamsFromPayload{
+		{"harbor.example.com/library/app:v1", "sha256:0123", []string{"app_v1"}},
+		{"harbor.example.com/library/app:v2", "sha256:4567", []string{"app_any"}},
+	}
+	if !reflect.DeepEqual(payload.targets, expectedTargets) {
+		t.Errorf("expected targets %+v, got %+v", expectedTargets, payload.targets)
+	}
+	expectedIgnored := []ignoredEvent{{"", "harbor.example.com/library/app@sha256:89ab", "push without tag"}}
+	if !reflect.DeepEqual(payload.ignored, expectedIgnored) {
+		t.Errorf("expected ignored %+v, got %+v", expectedIgnored, payload.ignored)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const inFlightPollInterval = 50 * time.Millisecond
+
+// inFlight - registry of running deploys, shutdown waits for it and reports what was interrupted
+type inFlight struct {
+	mu      sync.Mutex
+	next    int
+	running map[int]string
+}
+
+var inFlightDeploys = newInFlight()
+
+func newInFlight() *inFlight {
+	return &inFlight{running: map[int]string{}}
+}
+
+// start - registers a deploy, call returned func when it's finished
+func (f *inFlight) start(format string, a ...interface{}) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next++
+	id := f.next
+	f.running[id] = fmt.Sprintf("%s (since %s)", fmt.Sprintf(format, a...), time.Now().Format(time.RFC3339))
+	return func() {
+		f.mu.Lock()
+		delete(f.running, id)
+		f.mu.Unlock()
+	}
+}
+
+func (f *inFlight) list() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := make([]string, 0, len(f.running))
+	for _, desc := range f.running {
+		list = append(list, desc)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// wait - waits until all deploys are finished, returns deploys still running when ctx is done
+func (f *inFlight) wait(ctx context.Context) []string {
+	ticker := time.NewTicker(inFlightPollInterval)
+	defer ticker.Stop()
+	for {
+		if len(f.list()) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return f.list()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInFlightWait(t *testing.T) {
+	f := newInFlight()
+	if interrupted := f.wait(context.Background()); interrupted != nil {
+		t.Errorf("nothing is running, got %v", interrupted)
+	}
+
+	doneFast := f.start("%s => %s", "app:latest", "app_web")
+	doneSlow := f.start("%s => %s", "app:latest", "app_worker")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		doneFast()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	interrupted := f.wait(ctx)
+	if len(interrupted) != 1 || !strings.HasPrefix(interrupted[0], "app:latest => app_worker (since ") {
+		t.Errorf("expected only app_worker to be interrupted, got %v", interrupted)
+	}
+
+	doneSlow()
+	if interrupted := f.wait(context.Background()); interrupted != nil {
+		t.Errorf("all deploys are finished, got %v", interrupted)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jobsEndpoint = "/jobs/"
+
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+
+	jobWorkers   = 4
+	jobQueueSize = 100
+	jobsToKeep   = 1000
+)
+
+// deployJob - asynchronous deploy of one hook
+type deployJob struct {
+	ID       string         `json:"id"`
+	Status   string         `json:"status"`
+	Images   []string       `json:"images"`
+	Services []deployResult `json:"services,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Created  time.Time      `json:"created"`
+	Updated  time.Time      `json:"updated"`
+
+	handler *SwarmServiceHandler
+	targets []HookParamsFromPayload
+	done    func()
+}
+
+// jobStore - queue of deploy jobs and the last jobsToKeep of them for status requests
+type jobStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*deployJob
+	order []string
+	queue chan *deployJob
+	once  sync.Once
+}
+
+var deployJobs = newJobStore()
+
+func newJobStore() *jobStore {
+	return &jobStore{
+		jobs:  map[string]*deployJob{},
+		queue: make(chan *deployJob, jobQueueSize),
+	}
+}
+
+func newJobID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		Logz("can't read random job id: %s", err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// submit - queues deploy of targets with the handler (and its config) which received the hook
+func (s *jobStore) submit(h *SwarmServiceHandler, targets []HookParamsFromPayload) (deployJob, error) {
+	s.once.Do(func() {
+		for i := 0; i < jobWorkers; i++ {
+			go s.worker()
+		}
+	})
+	now := time.Now()
+	job := &deployJob{
+		ID:      newJobID(),
+		Status:  jobQueued,
+		Images:  targetImages(targets),
+		Created: now,
+		Updated: now,
+		handler: h,
+		targets: targets,
+	}
+	// queued jobs are in flight too, shutdown waits for them
+	job.done = inFlightDeploys.start("job %s %v", job.ID, job.Images)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- job:
+	default:
+		job.done()
+		return deployJob{}, errors.New("deploy queue is full")
+	}
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	s.prune()
+	Logz("job %s queued: %v", job.ID, job.Images)
+	return *job, nil
+}
+
+// prune - forgets the oldest finished jobs, must be called with mu held
+func (s *jobStore) prune() {
+	for i := 0; len(s.order) > jobsToKeep && i < len(s.order); {
+		id := s.order[i]
+		if status := s.jobs[id].Status; status == jobSucceeded || status == jobFailed {
+			delete(s.jobs, id)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+func (s *jobStore) get(id string) (deployJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return deployJob{}, false
+	}
+	return *job, true
+}
+
+func (s *jobStore) setStatus(job *deployJob, status string, results []deployResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.Status = status
+	job.Services = results
+	if err != nil {
+		job.Error = err.Error()
+	}
+	job.Updated = time.Now()
+}
+
+func (s *jobStore) worker() {
+	for job := range s.queue {
+		s.run(job)
+	}
+}
+
+func (s *jobStore) run(job *deployJob) {
+	defer job.done()
+	s.setStatus(job, jobRunning, nil, nil)
+	results, err := job.handler.deployTargets(job.targets)
+	status := jobSucceeded
+	if err != nil {
+		status = jobFailed
+	}
+	s.setStatus(job, status, results, err)
+	Logz("job %s %s", job.ID, status)
+}
+
+// jobsHandler - GET /jobs/{id}, protected with the same auth as webhooks
+type jobsHandler struct {
+	handler *reloadableHandler
+}
+
+func (h *jobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"bad method"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.handler.load().authorized(r, nil) {
+		http.Error(w, `{"error": "unauthorized"}`, http.StatusForbidden)
+		return
+	}
+	job, ok := deployJobs.get(strings.TrimPrefix(r.URL.Path, jobsEndpoint))
+	if !ok {
+		http.Error(w, `{"error": "job not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	wWrite(w, withouterrJSONMarshal(job))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncDeployJob(t *testing.T) {
+	config := testConfig
+	config.AsyncDeploy = true
+	handler := newReloadableHandler(&SwarmServiceHandler{config, testUpdateOpts})
+	mux := http.NewServeMux()
+	mux.Handle(jobsEndpoint, &jobsHandler{handler})
+	mux.Handle("/", handler)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	os.Remove(dockerSimpleSocket)
+	l, err := startSimpleSocketServer(dockerSimpleSocket, []DResp{
+		{http.StatusOK, []byte(fakeServiceInspectBody)},
+		{http.StatusOK, []byte(`{"Warnings": ["image is not pinned"]}`)},
+	})
+	if err != nil {
+		t.Fatalf("can't start fake docker: %s", err)
+	}
+	defer withouterrIOClose(l)
+	os.Setenv(dockerHostKey, "unix://"+dockerSimpleSocket)
+
+	key := fmt.Sprintf("?%s=%s", APIWebHookKeyName, config.APISecretKey)
+	resp, err := client.Post(ts.URL+APIEndpointWebHookRegistry+key, "application/json", strings.NewReader(payloadDockerService))
+	if err != nil {
+		t.Fatalf("request error: %s", err)
+	}
+	var accepted struct {
+		Status string
+		Job    string
+		URL    string
+	}
+	json.NewDecoder(resp.Body).Decode(&accepted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || accepted.Status != jobQueued || accepted.URL != jobsEndpoint+accepted.Job {
+		t.Fatalf("unexpected response: %d %+v", resp.StatusCode, accepted)
+	}
+
+	var job deployJob
+	for i := 0; i < 100; i++ {
+		resp, err := client.Get(ts.URL + accepted.URL + key)
+		if err != nil {
+			t.Fatalf("request error: %s", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if job.Status == jobSucceeded || job.Status == jobFailed {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if job.Status != jobSucceeded || len(job.Services) != 1 || job.Services[0].Warnings[0] != "image is not pinned" {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, accepted.URL + key, http.StatusMethodNotAllowed},
+		{http.MethodGet, accepted.URL, http.StatusForbidden},
+		{http.MethodGet, jobsEndpoint + "fake" + key, http.StatusNotFound},
+	}
+	for idx, c := range cases {
+		req, _ := http.NewRequest(c.method, ts.URL+c.path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("case %d: request error: %s", idx, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("case %d: expected status %d, got %d", idx, c.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestJobStorePrune(t *testing.T) {
+	s := newJobStore()
+	for i := 0; i < jobsToKeep+10; i++ {
+		id := fmt.Sprintf("job%d", i)
+		status := jobSucceeded
+		if i == 0 {
+			status = jobRunning
+		}
+		s.jobs[id] = &deployJob{ID: id, Status: status}
+		s.order = append(s.order, id)
+	}
+	s.prune()
+	if len(s.jobs) != jobsToKeep || len(s.order) != jobsToKeep {
+		t.Errorf("expected %d jobs, got %d", jobsToKeep, len(s.jobs))
+	}
+	if _, ok := s.get("job0"); !ok {
+		t.Errorf("running job must not be pruned")
+	}
+	if _, ok := s.get("job1"); ok {
+		t.Errorf("the oldest finished job must be pruned")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath - compiled JSONPath-style path of decoded json, string keys and int indexes
+type jsonPath []interface{}
+
+// parseJSONPath - "$" followed by ".key" and "[index]" steps
+func parseJSONPath(expr string) (jsonPath, error) {
+	var path jsonPath
+	rest := strings.TrimPrefix(expr, "$")
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty key in '%s'", expr)
+			}
+			path = append(path, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in '%s'", expr)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("bad index in '%s'", expr)
+			}
+			path = append(path, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected '%c' in '%s'", rest[0], expr)
+		}
+	}
+	return path, nil
+}
+
+// value - value at the path, nil if there is no such value
+func (p jsonPath) value(data interface{}) interface{} {
+	for _, step := range p {
+		switch step := step.(type) {
+		case string:
+			object, ok := data.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			data = object[step]
+		case int:
+			array, ok := data.([]interface{})
+			if !ok || step >= len(array) {
+				return nil
+			}
+			data = array[step]
+		}
+	}
+	return data
+}
+
+// stringValue - string at the path, empty if there is no string
+func (p jsonPath) stringValue(data interface{}) string {
+	value, _ := p.value(data).(string)
+	return value
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"image": {"name": "vorona/app", "tags": ["1.4.0", "latest"], "size": 15}}`), &data); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		expr  string
+		path  jsonPath
+		value interface{}
+	}{
+		{"$", nil, data},
+		{"$.image.name", jsonPath{"image", "name"}, "vorona/app"},
+		{"$.image.tags[1]", jsonPath{"image", "tags", 1}, "latest"},
+		{"$.image.tags[2]", jsonPath{"image", "tags", 2}, nil},
+		{"$.image.size", jsonPath{"image", "size"}, 15.0},
+		{"$.image.name.first", jsonPath{"image", "name", "first"}, nil},
+		{"$[0]", jsonPath{0}, nil},
+	}
+	for i, c := range cases {
+		path, err := parseJSONPath(c.expr)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(path, c.path) {
+			t.Errorf("case %d: expected path %#v, got %#v", i, c.path, path)
+		}
+		if value := path.value(data); !reflect.DeepEqual(value, c.value) {
+			t.Errorf("case %d: expected value %#v, got %#v", i, c.value, value)
+		}
+	}
+
+	if value := (jsonPath{"image", "size"}).stringValue(data); value != "" {
+		t.Errorf("expected empty string for a number, got %q", value)
+	}
+	for _, bad := range []string{"$..name", "$.tags[", "$.tags[-1]", "$.tags[x]", "$name"} {
+		if _, err := parseJSONPath(bad); err == nil {
+			t.Errorf("expected error for '%s'", bad)
+		}
+	}
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"docker.io/go-docker/api/types"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -23,6 +21,30 @@ const (
 	APIEndpointWebHookRegistry = "/webhook/registry/"
 	// APIEndpointWebHookDockerHub - just endpoint
 	APIEndpointWebHookDockerHub = "/webhook/dockerhub/"
+	// APIEndpointWebHookGitHub - GitHub Packages (ghcr.io) endpoint
+	APIEndpointWebHookGitHub = "/webhook/github/"
+	// APIEndpointWebHookGitLab - GitLab container registry endpoint
+	APIEndpointWebHookGitLab = "/webhook/gitlab/"
+	// APIEndpointWebHookHarbor - Harbor endpoint
+	APIEndpointWebHookHarbor = "/webhook/harbor/"
+	// APIEndpointWebHookQuay - Quay endpoint
+	APIEndpointWebHookQuay = "/webhook/quay/"
+	// APIEndpointWebHookArtifactory - JFrog Artifactory endpoint
+	APIEndpointWebHookArtifactory = "/webhook/artifactory/"
+	// APIEndpointWebHookNexus - Sonatype Nexus endpoint
+	APIEndpointWebHookNexus = "/webhook/nexus/"
+	// APIEndpointWebHookECR - AWS ECR events delivered by SNS endpoint
+	APIEndpointWebHookECR = "/webhook/ecr/"
+	// APIEndpointWebHookGCR - Google Artifact Registry Pub/Sub push endpoint
+	APIEndpointWebHookGCR = "/webhook/gcr/"
+	// APIEndpointWebHookACR - Azure Container Registry endpoint
+	APIEndpointWebHookACR = "/webhook/acr/"
+	// APIEndpointWebHookGitea - Gitea and Forgejo package registry endpoint
+	APIEndpointWebHookGitea = "/webhook/gitea/"
+	// APIEndpointWebHookCloudEvents - CloudEvents 1.0 endpoint
+	APIEndpointWebHookCloudEvents = "/webhook/cloudevents/"
+	// APIEndpointWebHookGeneric - prefix of configurable /webhook/generic/{name}/ endpoints
+	APIEndpointWebHookGeneric = "/webhook/generic/"
 )
 
 // CR is Case Response structure
@@ -30,8 +52,28 @@ type CR map[string]interface{}
 
 type mainConfig struct {
 	PrivateRegistry types.AuthConfig
-	Services        map[string]string // map[fullImageName]swarmServiceName
+	Services        map[string]serviceList // map[fullImageName]swarmServiceNames
+	Rules           []mappingRule          // checked in order when Services has no exact match
 	APISecretKey    string
+	PinDigest       bool            // deploy repo:tag@digest instead of mutable repo:tag
+	Signature       signatureConfig // HMAC request signing instead of APISecretKey
+	Shutdown        shutdownConfig
+	Convergence     convergenceConfig         // wait for rolling update and report its outcome
+	Rollback        map[string]rollbackPolicy // map[swarmServiceName]policy
+	AsyncDeploy     bool                      // answer 202 with job id, status is at GET /jobs/{id}
+	Retry           retryConfig
+	MediaTypes      []string // deployable manifest media types of registry events, defaults to deployableMediaTypes
+	GitHub          gitHubConfig
+	GitLab          gitLabConfig
+	Harbor          harborConfig
+	Artifactory     artifactoryConfig
+	Nexus           nexusConfig
+	ECR             ecrConfig
+	GCR             gcrConfig
+	ACR             acrConfig
+	Gitea           giteaConfig
+	CloudEvents     cloudEventsConfig
+	Generic         map[string]genericSource // map[name]source of /webhook/generic/{name}/
 }
 
 func main() {
@@ -43,28 +85,31 @@ func main() {
 
 func startService(addr string) (*http.Server, errExt) {
 	Logz("Staring webhookd service. %s", time.Now())
-	rawConfig, err := base64.URLEncoding.DecodeString(os.Getenv(configENVName))
-	if err != nil {
-		return nil, errExt{fmt.Sprintf("can't decode base64 value ENV[%s]: %s", configENVName, os.Getenv(configENVName)), err}
+	config, rawConfig, errC := loadConfig()
+	if errC.Err != nil {
+		return nil, errC
 	}
-	Logz("got environ param %s", configENVName)
-	var config mainConfig
-	err = json.Unmarshal(rawConfig, &config)
-	if err != nil {
-		return nil, errExt{fmt.Sprintf("can't decode json value: '%s'", rawConfig), err}
-	}
-	swarmUpdateOpts := types.ServiceUpdateOptions{
-		QueryRegistry:    true,
-		RegistryAuthFrom: createBase64AuthData(config.PrivateRegistry),
-	}
-	Logz("unmarshaled environ param %s", configENVName)
+	Logz("unmarshaled config")
+	handler := newReloadableHandler(&SwarmServiceHandler{config, newUpdateOpts(config)})
 	mux := http.NewServeMux()
 	s := &http.Server{Addr: addr, Handler: mux}
-	mux.Handle(shutdownEnpoint, &shutdownHandler{s})
-	mux.Handle("/", &SwarmServiceHandler{config, swarmUpdateOpts})
+	gs := newGracefulServer(s)
+	mux.Handle(shutdownEnpoint, &shutdownHandler{gs, handler})
+	mux.Handle(jobsEndpoint, &jobsHandler{handler})
+	mux.Handle("/", handler)
+	if path := os.Getenv(configFileENVName); path != "" {
+		stop := make(chan struct{})
+		defer close(stop)
+		go newConfigWatcher(path, handler, rawConfig).run(stop)
+	}
+	stopSignals := gs.drainOnSignal(func() time.Duration {
+		return handler.load().config.Shutdown.timeout()
+	})
+	defer stopSignals()
 	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return nil, errExt{fmt.Sprintf("can't bind service to %s", addr), err}
 	}
+	gs.wait()
 	//Logz("stopping server at %s\n", addr)
 	return s, errExt{"OK", nil}
 }
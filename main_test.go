@@ -90,6 +90,7 @@ type Case struct {
 	Path    string
 	Query   string
 	Payload string
+	Headers map[string]string
 	DHost   string
 	DResp   []DResp
 	Status  int
@@ -109,9 +110,9 @@ var (
 			Password:      "thixie6loh9Uemier8hoh0se",
 			ServerAddress: "docker-registry.private-host.com",
 		},
-		Services: map[string]string{
-			"docker-registry.private-host.com/projectq-app:latest": "projectq-stack-latest_backend",
-			"vorona/docker-deploy-webhook:latest":                  "docker-deploy-webhook",
+		Services: map[string]serviceList{
+			"docker-registry.private-host.com/projectq-app:latest": {"projectq-stack-latest_backend"},
+			"vorona/docker-deploy-webhook:latest":                  {"docker-deploy-webhook"},
 		},
 		APISecretKey: "EF3rf34g3gfR2G3r3grf",
 	}
@@ -220,7 +221,8 @@ func TestPayloadParsingRegistry(t *testing.T) {
 			Payload: payloadDockerService,
 			DHost:   "unix:///var/run/fake.sock",
 			Result: CR{
-				"error": "can't connect to service projectq-stack-latest_backend: Cannot connect to the Docker daemon at unix:///var/run/fake.sock. Is the docker daemon running?",
+				"error":    "can't connect to service projectq-stack-latest_backend: Cannot connect to the Docker daemon at unix:///var/run/fake.sock. Is the docker daemon running?",
+				"services": []CR{failedDeployResult("can't connect to service projectq-stack-latest_backend: Cannot connect to the Docker daemon at unix:///var/run/fake.sock. Is the docker daemon running?")},
 			},
 		},
 		{ // case 3
@@ -231,7 +233,8 @@ func TestPayloadParsingRegistry(t *testing.T) {
 			Payload: payloadDockerService,
 			DHost:   "http://:65666",
 			Result: CR{
-				"error": "can't connect to service projectq-stack-latest_backend: error during connect: Get http://:65666/v1.33/services/projectq-stack-latest_backend?insertDefaults=false: dial tcp: address 65666: invalid port",
+				"error":    "can't connect to service projectq-stack-latest_backend: error during connect: Get http://:65666/v1.33/services/projectq-stack-latest_backend?insertDefaults=false: dial tcp: address 65666: invalid port",
+				"services": []CR{failedDeployResult("can't connect to service projectq-stack-latest_backend: error during connect: Get http://:65666/v1.33/services/projectq-stack-latest_backend?insertDefaults=false: dial tcp: address 65666: invalid port")},
 			},
 		},
 	}
@@ -240,7 +243,8 @@ func TestPayloadParsingRegistry(t *testing.T) {
 }
 
 func TestPayloadParsingRegistry2ndConfig(t *testing.T) {
-	config := mainConfig{}
+	// an empty key is never accepted, so the minimal config has only the key
+	config := mainConfig{APISecretKey: testConfig.APISecretKey}
 	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
 
 	cases := []Case{
@@ -250,18 +254,17 @@ func TestPayloadParsingRegistry2ndConfig(t *testing.T) {
 			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
 			Status:  http.StatusOK,
 			Payload: payloadDockerService,
-			Result: CR{
-				"error": "empty ServiceName, exit. IMG: docker-registry.private-host.com/projectq-app:latest",
-			},
+			Result:  unmappedResult("docker-registry.private-host.com/projectq-app:latest"),
 		},
 		{ // TestPayloadParsingRegistry2ndConfig case 1
 			Path:    APIEndpointWebHookRegistry,
 			Method:  http.MethodPost,
 			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
-			Status:  http.StatusBadRequest,
+			Status:  http.StatusOK,
 			Payload: `{"events": [{"action": "pull"}]}`,
 			Result: CR{
-				"error": "can't decode payload: PULL is an excluded method",
+				"error":   "nothing to deploy",
+				"ignored": []CR{{"reason": "action pull is ignored"}},
 			},
 		},
 	}
@@ -280,9 +283,7 @@ func TestPayloadParsingHub(t *testing.T) {
 			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
 			Status:  http.StatusOK,
 			Payload: payloadDockerHub,
-			Result: CR{
-				"error": "empty ServiceName, exit. IMG: svendowideit/testhook:latest",
-			},
+			Result:  unmappedResult("svendowideit/testhook:latest"),
 		},
 		{ // case 1
 			Path:    APIEndpointWebHookDockerHub,
@@ -327,17 +328,21 @@ func TestShutdownHandler_ServeHTTP(t *testing.T) {
 		}
 	}()
 	time.Sleep(20 * time.Millisecond)
-	req, errR := http.NewRequest("GET", "http://"+url+shutdownEnpoint, nil)
+	req, errR := http.NewRequest("POST", "http://"+url+shutdownEnpoint+"?"+APIWebHookKeyName+"="+testConfig.APISecretKey, nil)
 	if errR != nil {
 		t.Errorf("request001 error: %v", errR)
 		return
 	}
-	_, err := client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		t.Errorf("responce001 error: %v", err)
 		return
 	}
-	//Logz("%v", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("responce001 status: %v", resp.Status)
+	}
+	resp.Body.Close()
+	time.Sleep(20 * time.Millisecond)
 	_, err = client.Do(req)
 	if err != nil {
 		return
@@ -397,6 +402,9 @@ func runCase(t *testing.T, ts *httptest.Server, idx int, item Case, cfg mainConf
 	} else {
 		req, _ = http.NewRequest(item.Method, url, nil)
 	}
+	for k, v := range item.Headers {
+		req.Header.Set(k, v)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -442,6 +450,22 @@ func runChechconfigENVName(t *testing.T, testBase64String, expectedError string)
 	}
 }
 
+func unmappedResult(image string) CR {
+	return CR{
+		"error":   "nothing to deploy",
+		"ignored": []CR{{"image": image, "reason": "empty ServiceName"}},
+	}
+}
+
+func failedDeployResult(err string) CR {
+	return CR{
+		"service": "projectq-stack-latest_backend",
+		"image":   "docker-registry.private-host.com/projectq-app:latest",
+		"status":  "FAILED",
+		"error":   err,
+	}
+}
+
 func convertInterfaceToBase64String(i interface{}) string {
 	data, err := json.Marshal(i)
 	if err != nil {
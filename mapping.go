@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// serviceList - one or many swarm services, in json it's a string or an array of strings
+type serviceList []string
+
+// UnmarshalJSON - accepts "service" as well as ["service1", "service2"]
+func (l *serviceList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = serviceList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("service must be a string or an array of strings")
+	}
+	*l = list
+	return nil
+}
+
+func (l serviceList) validate() error {
+	if len(l) == 0 {
+		return errors.New("empty service list")
+	}
+	for _, service := range l {
+		if service == "" {
+			return errors.New("empty service name")
+		}
+	}
+	return nil
+}
+
+// mappingRule - image pattern to swarm service rule.
+// Image is a glob in path.Match syntax ("*" doesn't match "/"),
+// Regexp is a regular expression matched against the whole image string,
+// its capture groups can be used in Service as $1, ${1} or ${name}.
+type mappingRule struct {
+	Image   string
+	Regexp  string
+	Service serviceList
+
+	re *regexp.Regexp // compiled Regexp, set by validate
+}
+
+// validate - checks the rule and compiles its Regexp
+func (r *mappingRule) validate() error {
+	if err := r.Service.validate(); err != nil {
+		return fmt.Errorf("bad Service: %s", err)
+	}
+	if (r.Image == "") == (r.Regexp == "") {
+		return errors.New("exactly one of Image or Regexp must be set")
+	}
+	if r.Image != "" {
+		if _, err := path.Match(r.Image, ""); err != nil {
+			return fmt.Errorf("bad Image pattern '%s': %s", r.Image, err)
+		}
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + r.Regexp + ")$")
+	if err != nil {
+		return err
+	}
+	r.re = re
+	return nil
+}
+
+// match - returns service names for image and true if the rule matches
+func (r *mappingRule) match(image string) (serviceList, bool) {
+	if r.Image != "" {
+		if ok, _ := path.Match(r.Image, image); ok {
+			return r.Service, true
+		}
+		return nil, false
+	}
+	re := r.re
+	if re == nil {
+		Logz("skipping rule with not validated Regexp '%s'", r.Regexp)
+		return nil, false
+	}
+	submatches := re.FindStringSubmatchIndex(image)
+	if submatches == nil {
+		return nil, false
+	}
+	services := make(serviceList, 0, len(r.Service))
+	for _, service := range r.Service {
+		services = append(services, string(re.ExpandString(nil, service, image, submatches)))
+	}
+	return services, true
+}
+
+// servicesFor - finds swarm services for image.
+// Exact Services keys win, then Rules are checked in order, the first match wins.
+func (c *mainConfig) servicesFor(image string) serviceList {
+	if services := c.Services[image]; len(services) > 0 {
+		return services
+	}
+	for i := range c.Rules {
+		if services, ok := c.Rules[i].match(image); ok {
+			return services
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMainConfigServiceFor(t *testing.T) {
+	config := mainConfig{
+		Services: map[string]serviceList{
+			"registry/app:1.4.0": {"exact_web"},
+			"registry/app:stage": {"stage_web", "stage_worker", "stage_scheduler"},
+		},
+		Rules: []mappingRule{
+			{Image: "registry/app:1.4.*", Service: serviceList{"release_web"}},
+			{Regexp: `registry/app:pr-(\d+)`, Service: serviceList{"preview-${1}_web", "preview-${1}_worker"}},
+			{Regexp: `registry/(?P<name>[a-z]+):stage`, Service: serviceList{"stage_${name}"}},
+			{Image: "registry/*:*", Service: serviceList{"fallback"}},
+		},
+	}
+	if err := config.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]serviceList{
+		"registry/app:1.4.0":        {"exact_web"},
+		"registry/app:stage":        {"stage_web", "stage_worker", "stage_scheduler"},
+		"registry/app:1.4.2-abc123": {"release_web"},
+		"registry/app:pr-512":       {"preview-512_web", "preview-512_worker"},
+		"registry/app:pr-512x":      {"fallback"},
+		"registry/worker:stage":     {"stage_worker"},
+		"registry/app:1.5.0":        {"fallback"},
+		"other/app:1.4.0":           nil,
+		"registry/nested/app:1.4.0": nil,
+	}
+	for image, expected := range cases {
+		if services := config.servicesFor(image); !reflect.DeepEqual(services, expected) {
+			t.Errorf("image %s: expected services %v, got %v", image, expected, services)
+		}
+	}
+}
+
+func TestServiceListUnmarshalJSON(t *testing.T) {
+	var config mainConfig
+	raw := `{"Services": {"app:latest": "web", "app:stage": ["web", "worker"]}, "Rules": [{"Image": "app:*", "Service": "any"}]}`
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(config.Services["app:latest"], serviceList{"web"}) ||
+		!reflect.DeepEqual(config.Services["app:stage"], serviceList{"web", "worker"}) ||
+		!reflect.DeepEqual(config.Rules[0].Service, serviceList{"any"}) {
+		t.Errorf("unexpected config: %+v", config)
+	}
+
+	for _, bad := range []string{
+		`{"Services": {"app:latest": 1}}`,
+		`{"Services": {"app:latest": []}}`,
+		`{"Services": {"app:latest": ["web", ""]}}`,
+		`{"Services": {"": "web"}}`,
+	} {
+		if _, err := parseConfig([]byte(bad)); err == nil {
+			t.Errorf("expected error for config: %s", bad)
+		}
+	}
+}
+
+func TestMappingRuleValidate(t *testing.T) {
+	bad := []mappingRule{
+		{Image: "app:*"},
+		{Service: serviceList{"web"}},
+		{Image: "app:*", Regexp: "app:.*", Service: serviceList{"web"}},
+		{Image: "app:[", Service: serviceList{"web"}},
+		{Regexp: "app:(", Service: serviceList{"web"}},
+	}
+	for i, rule := range bad {
+		config := mainConfig{Rules: []mappingRule{rule}}
+		if err := config.validate(); err == nil {
+			t.Errorf("case %d: expected validation error for %+v", i, rule)
+		}
+	}
+
+	// rule which slipped through validation is skipped
+	rule := mappingRule{Regexp: "app:.*", Service: serviceList{"web"}}
+	if _, ok := rule.match("app:latest"); ok {
+		t.Errorf("not validated regexp must not match")
+	}
+}
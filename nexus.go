@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	nexusSignatureHeader = "X-Nexus-Webhook-Signature"
+	nexusFormatDocker    = "docker"
+)
+
+// nexusConfig - Sonatype Nexus repository webhook, Secret is the "Secret Key" of the webhook capability.
+// Nexus docker repositories are served by their own connectors, Registries maps repository names to them.
+type nexusConfig struct {
+	Secret     string
+	Registries map[string]string // map[repositoryName]host:port
+}
+
+// NexusPayload - payload of Nexus "repository component" webhook
+type NexusPayload struct {
+	RepositoryName string
+	Action         string
+	Component      struct {
+		Format  string
+		Name    string
+		Version string
+	}
+}
+
+// nexusDeployActions - a new tag is CREATED, an existing tag pushed again is UPDATED
+var nexusDeployActions = map[string]bool{
+	"CREATED": true,
+	"UPDATED": true,
+}
+
+// authorizeNexus - Nexus signs the payload with HMAC-SHA1 and sends it hex encoded
+func authorizeNexus(c *mainConfig, r *http.Request, body []byte) error {
+	if c.Nexus.Secret == "" {
+		return errors.New("Nexus.Secret is not configured")
+	}
+	signature := r.Header.Get(nexusSignatureHeader)
+	if signature == "" {
+		return errors.New("missing " + nexusSignatureHeader + " header")
+	}
+	received, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("bad " + nexusSignatureHeader + " header: " + err.Error())
+	}
+	mac := hmac.New(sha1.New, []byte(c.Nexus.Secret))
+	mac.Write(body)
+	if !hmac.Equal(received, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func (h *SwarmServiceHandler) nexusPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := NexusPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookNexus, payload)
+	component := payload.Component
+	if component.Name == "" {
+		return result, errors.New("payload without component")
+	}
+	image := component.Name
+	if component.Version != "" {
+		image += ":" + component.Version
+	}
+	if !nexusDeployActions[payload.Action] {
+		result.ignore("", image, "action "+payload.Action+" is ignored")
+		return result, nil
+	}
+	if component.Format != nexusFormatDocker {
+		result.ignore("", image, "format "+component.Format+" is not deployable")
+		return result, nil
+	}
+	registry := h.config.Nexus.Registries[payload.RepositoryName]
+	if registry == "" {
+		result.ignore("", image, "repository "+payload.RepositoryName+" has no registry in Nexus.Registries")
+		return result, nil
+	}
+	if component.Version == "" {
+		result.ignore("", registry+"/"+image, "push without tag")
+		return result, nil
+	}
+
+	var params HookParamsFromPayload
+	params.registryImage = registry + "/" + image
+	params.serviceNames = h.config.servicesFor(params.registryImage)
+	result.add(params)
+	return result, nil
+}
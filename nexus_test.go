@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testNexusSecret         = "ooNg1queeY7zai4e"
+	payloadNexusComponentOK = `{
+  "timestamp": "2018-11-10T23:57:49.664+0000",
+  "nodeId": "52905B51-085CCABB-CEBBEAAD-16F95F3E-9B8E36E4",
+  "initiator": "ci/10.0.0.12",
+  "repositoryName": "docker-hosted",
+  "action": "CREATED",
+  "component": {
+    "id": "08909bf0c86cf6c9",
+    "componentId": "ZG9ja2VyLWhvc3RlZDowODkwOWJmMGM4NmNmNmM5",
+    "format": "docker",
+    "name": "vorona/app",
+    "group": null,
+    "version": "1.4.0"
+  }
+}`
+)
+
+func testNexusSignature(secret, content string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNexusWebhook(t *testing.T) {
+	config := testConfig
+	config.Nexus = nexusConfig{Secret: testNexusSecret, Registries: map[string]string{"docker-hosted": "nexus.example.com:8083"}}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	signed := func(payload string) map[string]string {
+		return map[string]string{nexusSignatureHeader: testNexusSignature(testNexusSecret, payload)}
+	}
+	payloadDeleted := `{"repositoryName": "docker-hosted", "action": "DELETED", "component": {"format": "docker", "name": "vorona/app", "version": "1.4.0"}}`
+	payloadMaven := `{"repositoryName": "maven-releases", "action": "CREATED", "component": {"format": "maven2", "name": "app", "version": "1.4.0"}}`
+	payloadOtherRepo := `{"repositoryName": "docker-proxy", "action": "CREATED", "component": {"format": "docker", "name": "vorona/app", "version": "1.4.0"}}`
+
+	cases := []Case{
+		{ // case 0: ?key= isn't accepted
+			Path:    APIEndpointWebHookNexus,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusForbidden,
+			Payload: payloadNexusComponentOK,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookNexus,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: payloadNexusComponentOK,
+			Headers: map[string]string{nexusSignatureHeader: testNexusSignature("wrong", payloadNexusComponentOK)},
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookNexus,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadNexusComponentOK,
+			Headers: signed(payloadNexusComponentOK),
+			Result:  unmappedResult("nexus.example.com:8083/vorona/app:1.4.0"),
+		},
+		{ // case 3
+			Path:    APIEndpointWebHookNexus,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadDeleted,
+			Headers: signed(payloadDeleted),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "vorona/app:1.4.0", "reason": "action DELETED is ignored"}}},
+		},
+		{ // case 4
+			Path:    APIEndpointWebHookNexus,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadMaven,
+			Headers: signed(payloadMaven),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "app:1.4.0", "reason": "format maven2 is not deployable"}}},
+		},
+		{ // case 5
+			Path:    APIEndpointWebHookNexus,
+			Method:  http.MethodPost,
+			Status:  http.StatusOK,
+			Payload: payloadOtherRepo,
+			Headers: signed(payloadOtherRepo),
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "vorona/app:1.4.0", "reason": "repository docker-proxy has no registry in Nexus.Registries"}}},
+		},
+	}
+	runTests(t, ts, cases, config)
+}
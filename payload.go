@@ -0,0 +1,126 @@
+package main
+
+import (
+	"github.com/docker/distribution/notifications"
+)
+
+// deployableMediaTypes - manifests and manifest lists, pushes of layers and image configs aren't deployable
+var deployableMediaTypes = map[string]bool{
+	"application/vnd.docker.distribution.manifest.v1+json":      true,
+	"application/vnd.docker.distribution.manifest.v1+prettyjws": true,
+	"application/vnd.docker.distribution.manifest.v2+json":      true,
+	"application/vnd.docker.distribution.manifest.list.v2+json": true,
+	"application/vnd.oci.image.manifest.v1+json":                true,
+	"application/vnd.oci.image.index.v1+json":                   true,
+}
+
+// hookPayload - what a webhook payload asks to deploy, one target per image
+type hookPayload struct {
+	targets []HookParamsFromPayload
+	ignored []ignoredEvent
+}
+
+// ignoredEvent - event of the payload which is not deployed and why
+type ignoredEvent struct {
+	Event  string `json:"event,omitempty"`
+	Image  string `json:"image,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// add - adds target, the same image pushed twice in one payload is deployed once, the later push wins
+func (p *hookPayload) add(params HookParamsFromPayload) {
+	for i := range p.targets {
+		if p.targets[i].registryImage == params.registryImage {
+			p.targets[i] = params
+			return
+		}
+	}
+	p.targets = append(p.targets, params)
+}
+
+func (p *hookPayload) ignore(event, image, reason string) {
+	p.ignored = append(p.ignored, ignoredEvent{event, image, reason})
+}
+
+// ignoreUnmapped - moves targets without services to ignored
+func (p *hookPayload) ignoreUnmapped() {
+	targets := p.targets[:0]
+	for _, params := range p.targets {
+		if len(params.serviceNames) == 0 {
+			p.ignore("", params.registryImage, "empty ServiceName")
+			continue
+		}
+		targets = append(targets, params)
+	}
+	p.targets = targets
+}
+
+// response - adds ignored events to the response if there are any
+func (p *hookPayload) response(resp CR) CR {
+	if len(p.ignored) > 0 {
+		resp["ignored"] = p.ignored
+	}
+	return resp
+}
+
+func targetImages(targets []HookParamsFromPayload) []string {
+	images := make([]string, 0, len(targets))
+	for _, params := range targets {
+		images = append(images, params.registryImage)
+	}
+	return images
+}
+
+// addRegistryEvents - adds deployable events of a docker registry notification envelope, the rest is ignored
+func (h *SwarmServiceHandler) addRegistryEvents(result *hookPayload, events []notifications.Event) {
+	for _, event := range events {
+		params, reason := h.config.registryEventParams(event)
+		if reason != "" {
+			result.ignore(event.ID, params.registryImage, reason)
+			continue
+		}
+		params.serviceNames = h.config.servicesFor(params.registryImage)
+		result.add(params)
+	}
+}
+
+// deployableMediaType - checks mediaType against MediaTypes of the config or deployableMediaTypes if it's not set
+func (c *mainConfig) deployableMediaType(mediaType string) bool {
+	if len(c.MediaTypes) == 0 {
+		return deployableMediaTypes[mediaType]
+	}
+	for _, allowed := range c.MediaTypes {
+		if allowed == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// registryEventParams - image of the docker registry event or the reason why it's not deployable
+func (c *mainConfig) registryEventParams(event notifications.Event) (HookParamsFromPayload, string) {
+	var params HookParamsFromPayload
+	if event.Target.Repository != "" {
+		params.registryImage = event.Request.Host + "/" + event.Target.Repository
+		if event.Target.Tag != "" {
+			params.registryImage += ":" + event.Target.Tag
+		}
+	}
+	if event.Action != notifications.EventActionPush {
+		return params, "action " + event.Action + " is ignored"
+	}
+	if event.Target.MediaType == "" {
+		return params, "media type is empty"
+	}
+	if !c.deployableMediaType(event.Target.MediaType) {
+		return params, "media type " + event.Target.MediaType + " is not deployable"
+	}
+	if event.Target.Repository == "" {
+		return params, "repository is empty"
+	}
+	if event.Target.Tag == "" {
+		return params, "push without tag"
+	}
+	params.digest = event.Target.Digest.String()
+	return params, ""
+}
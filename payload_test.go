@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/docker/distribution/notifications"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const payloadRegistryManyEvents = `{"events": [
+	{"id": "e1", "action": "pull", "target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "repository": "app", "tag": "stage"}, "request": {"host": "registry"}},
+	{"id": "e2", "action": "push", "target": {"mediaType": "application/octet-stream", "repository": "app", "tag": "stage"}, "request": {"host": "registry"}},
+	{"id": "e3", "action": "push", "target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "digest": "sha256:0123", "repository": "app", "tag": "stage"}, "request": {"host": "registry"}},
+	{"id": "e4", "action": "push", "target": {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:4567", "repository": "other", "tag": "latest"}, "request": {"host": "registry"}},
+	{"id": "e5", "action": "push", "target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "digest": "sha256:89ab", "repository": "app", "tag": "stage"}, "request": {"host": "registry"}}
+]}`
+
+func TestRegistryPayloadManyEvents(t *testing.T) {
+	config := testConfig
+	config.Services = map[string]serviceList{"registry/app:stage": {"stage_web", "stage_worker"}}
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(payloadRegistryManyEvents), APIEndpointWebHookRegistry, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	payload.ignoreUnmapped()
+
+	expectedTargets := []HookParamsFromPayload{
+		{"registry/app:stage", "sha256:89ab", []string{"stage_web", "stage_worker"}},
+	}
+	if !reflect.DeepEqual(payload.targets, expectedTargets) {
+		t.Errorf("expected targets %+v, got %+v", expectedTargets, payload.targets)
+	}
+
+	expectedIgnored := []ignoredEvent{
+		{"e1", "registry/app:stage", "action pull is ignored"},
+		{"e2", "registry/app:stage", "media type application/octet-stream is not deployable"},
+		{"", "registry/other:latest", "empty ServiceName"},
+	}
+	if !reflect.DeepEqual(payload.ignored, expectedIgnored) {
+		t.Errorf("expected ignored %+v, got %+v", expectedIgnored, payload.ignored)
+	}
+}
+
+func TestRegistryEventParamsMediaTypes(t *testing.T) {
+	event := func(mediaType, tag string) notifications.Event {
+		var e notifications.Event
+		e.Action = notifications.EventActionPush
+		e.Target.MediaType = mediaType
+		e.Target.Repository = "app"
+		e.Target.Tag = tag
+		e.Request.Host = "registry"
+		return e
+	}
+	const (
+		manifestV2  = "application/vnd.docker.distribution.manifest.v2+json"
+		ociManifest = "application/vnd.oci.image.manifest.v1+json"
+	)
+
+	cases := []struct {
+		config mainConfig
+		event  notifications.Event
+		image  string
+		reason string
+	}{
+		{mainConfig{}, event(manifestV2, "latest"), "registry/app:latest", ""},
+		{mainConfig{}, event(ociManifest, "latest"), "registry/app:latest", ""},
+		{mainConfig{}, event("application/octet-stream", ""), "registry/app", "media type application/octet-stream is not deployable"},
+		{mainConfig{}, event("", "latest"), "registry/app:latest", "media type is empty"},
+		{mainConfig{}, event(manifestV2, ""), "registry/app", "push without tag"},
+		{mainConfig{MediaTypes: []string{manifestV2}}, event(manifestV2, "latest"), "registry/app:latest", ""},
+		{mainConfig{MediaTypes: []string{manifestV2}}, event(ociManifest, "latest"), "registry/app:latest", "media type " + ociManifest + " is not deployable"},
+	}
+	for i, c := range cases {
+		params, reason := c.config.registryEventParams(c.event)
+		if params.registryImage != c.image || reason != c.reason {
+			t.Errorf("case %d: expected %q %q, got %q %q", i, c.image, c.reason, params.registryImage, reason)
+		}
+	}
+
+	if _, err := parseConfig([]byte(`{"MediaTypes": ["application/vnd.docker.distribution.manifest.v2+json", ""]}`)); err == nil {
+		t.Errorf("expected error for empty media type")
+	}
+}
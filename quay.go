@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// QuayPayload - payload of Quay "Push to Repository" notification
+type QuayPayload struct {
+	Repository  string
+	DockerURL   string   `json:"docker_url"`
+	UpdatedTags []string `json:"updated_tags"`
+}
+
+func (h *SwarmServiceHandler) quayPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := QuayPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookQuay, payload)
+	if payload.DockerURL == "" {
+		return result, errors.New("payload without docker_url")
+	}
+	if len(payload.UpdatedTags) == 0 {
+		result.ignore("", payload.DockerURL, "push without tag")
+		return result, nil
+	}
+	for _, tag := range payload.UpdatedTags {
+		var params HookParamsFromPayload
+		params.registryImage = payload.DockerURL + ":" + tag
+		params.serviceNames = h.config.servicesFor(params.registryImage)
+		result.add(params)
+	}
+	return result, nil
+}
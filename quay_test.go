@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const payloadQuayPush = `{
+  "repository": "vorona/app",
+  "namespace": "vorona",
+  "name": "app",
+  "docker_url": "quay.io/vorona/app",
+  "homepage": "https://quay.io/repository/vorona/app",
+  "updated_tags": ["latest", "1.4.0", "latest"]
+}`
+
+func TestQuayWebhook(t *testing.T) {
+	config := testConfig
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	query := fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey)
+
+	cases := []Case{
+		{ // case 0
+			Path:    APIEndpointWebHookQuay,
+			Method:  http.MethodPost,
+			Status:  http.StatusForbidden,
+			Payload: payloadQuayPush,
+			Result:  CR{"error": "unauthorized"},
+		},
+		{ // case 1
+			Path:    APIEndpointWebHookQuay,
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusBadRequest,
+			Payload: `{"repository": "vorona/app"}`,
+			Result:  CR{"error": "can't decode payload: payload without docker_url"},
+		},
+		{ // case 2
+			Path:    APIEndpointWebHookQuay,
+			Method:  http.MethodPost,
+			Query:   query,
+			Status:  http.StatusOK,
+			Payload: `{"docker_url": "quay.io/vorona/app", "updated_tags": []}`,
+			Result:  CR{"error": "nothing to deploy", "ignored": []CR{{"image": "quay.io/vorona/app", "reason": "push without tag"}}},
+		},
+	}
+	runTests(t, ts, cases, config)
+}
+
+func TestQuayPayloadTags(t *testing.T) {
+	config := testConfig
+	config.Services = map[string]serviceList{"quay.io/vorona/app:latest": {"app_latest"}}
+	h := &SwarmServiceHandler{config, testUpdateOpts}
+
+	payload, err := h.getHookParamsFromPayload(strings.NewReader(payloadQuayPush), APIEndpointWebHookQuay, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	payload.ignoreUnmapped()
+	expectedTargets := []HookParamsFromPayload{{"quay.io/vorona/app:latest", "", []string{"app_latest"}}}
+	if !reflect.DeepEqual(payload.targets, expectedTargets) {
+		t.Errorf("expected targets %+v, got %+v", expectedTargets, payload.targets)
+	}
+	expectedIgnored := []ignoredEvent{{"", "quay.io/vorona/app:1.4.0", "empty ServiceName"}}
+	if !reflect.DeepEqual(payload.ignored, expectedIgnored) {
+		t.Errorf("expected ignored %+v, got %+v", expectedIgnored, payload.ignored)
+	}
+}
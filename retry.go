@@ -0,0 +1,79 @@
+package main
+
+import (
+	"docker.io/go-docker"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+// retryConfig - how updateService retries version conflicts and transient engine errors
+type retryConfig struct {
+	Attempts   int      // total attempts, 1 (no retries) by default
+	Backoff    duration // delay before the 2nd attempt, doubled for every next one, default 1s
+	MaxBackoff duration // default 30s
+}
+
+func (c *retryConfig) attempts() int {
+	if c.Attempts > 1 {
+		return c.Attempts
+	}
+	return 1
+}
+
+// backoff - delay after failed attempt number n, n starts from 1
+func (c *retryConfig) backoff(n int) time.Duration {
+	delay, limit := c.Backoff.Duration, c.MaxBackoff.Duration
+	if delay <= 0 {
+		delay = defaultRetryBackoff
+	}
+	if limit <= 0 {
+		limit = defaultRetryMaxBackoff
+	}
+	for i := 1; i < n && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		return limit
+	}
+	return delay
+}
+
+// updateError - error for the response with the docker error kept for retry decision
+type updateError struct {
+	message string
+	cause   error
+}
+
+func (e *updateError) Error() string {
+	return e.message
+}
+
+// retryReason - why err is worth another attempt, "" if it isn't
+func retryReason(err error) string {
+	if e, ok := err.(*updateError); ok {
+		err = e.cause
+	}
+	if err == nil {
+		return ""
+	}
+	if strings.Contains(err.Error(), "update out of sequence") {
+		return "version conflict"
+	}
+	if docker.IsErrConnectionFailed(err) {
+		return "docker engine is unreachable"
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return "timeout"
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF || strings.Contains(err.Error(), "connection reset by peer") {
+		return "connection dropped"
+	}
+	return ""
+}
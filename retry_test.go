@@ -0,0 +1,94 @@
+package main
+
+import (
+	"docker.io/go-docker"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryConfigBackoff(t *testing.T) {
+	c := retryConfig{Backoff: duration{100 * time.Millisecond}, MaxBackoff: duration{time.Second}}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, e := range expected {
+		if delay := c.backoff(i + 1); delay != e {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, e, delay)
+		}
+	}
+	if delay := (&retryConfig{}).backoff(1); delay != defaultRetryBackoff {
+		t.Errorf("expected default backoff, got %s", delay)
+	}
+	if attempts := (&retryConfig{}).attempts(); attempts != 1 {
+		t.Errorf("expected 1 attempt by default, got %d", attempts)
+	}
+}
+
+func TestRetryReason(t *testing.T) {
+	cases := map[error]bool{
+		errors.New("rpc error: code = Unknown desc = update out of sequence"): true,
+		docker.ErrorConnectionFailed("unix:///var/run/docker.sock"):           true,
+		&updateError{"wrapped", io.ErrUnexpectedEOF}:                          true,
+		&updateError{"wrapped", errors.New("No such service: web")}:           false,
+		errors.New("Error response from daemon: {}"):                          false,
+		nil: false,
+	}
+	for err, retryable := range cases {
+		if reason := retryReason(err); (reason != "") != retryable {
+			t.Errorf("%v: expected retryable=%v, got reason '%s'", err, retryable, reason)
+		}
+	}
+}
+
+func TestSwarmRetryOutOfSequence(t *testing.T) {
+	config := testConfig
+	config.Retry = retryConfig{Attempts: 3, Backoff: duration{time.Millisecond}}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	conflict := []byte(`{"message": "rpc error: code = Unknown desc = update out of sequence"}`)
+	cases := []Case{
+		{ // case 0: conflict, the 2nd attempt succeeds
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusOK,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, []byte(fakeServiceInspectBody)},
+				{http.StatusInternalServerError, conflict},
+				{http.StatusOK, []byte(fakeServiceInspectBody)},
+				{http.StatusOK, []byte(`{}`)},
+			},
+			Result: CR{
+				"status": "OK",
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "docker-registry.private-host.com/projectq-app:latest",
+					"status":  "OK",
+				}},
+			},
+		},
+		{ // case 1: not retryable error, the only attempt
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusBadRequest,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, []byte(fakeServiceInspectBody)},
+				{http.StatusBadGateway, []byte(`{}`)},
+			},
+			Result: CR{
+				"error":    "updating a service: knmtuvl25atbbpmsra8yl6daz, Error response from daemon: {}",
+				"services": []CR{failedDeployResult("updating a service: knmtuvl25atbbpmsra8yl6daz, Error response from daemon: {}")},
+			},
+		},
+	}
+
+	runTests(t, ts, cases, config)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/filters"
+	"docker.io/go-docker/api/types/swarm"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRollbackDeadline = 2 * time.Minute
+
+	// rolloutStateRolledBack - not a swarm state, the webhook has rolled the service back
+	rolloutStateRolledBack = "rolled_back"
+)
+
+// rollbackPolicy - the service is rolled back to the previous spec
+// if its new tasks aren't running within Deadline. Tasks with a healthcheck
+// are reported as running by swarm only after they become healthy.
+type rollbackPolicy struct {
+	Deadline duration // default 2m
+}
+
+func (p *rollbackPolicy) deadline() time.Duration {
+	if p.Deadline.Duration > 0 {
+		return p.Deadline.Duration
+	}
+	return defaultRollbackDeadline
+}
+
+// ensureHealthy - waits for new tasks of the service and rolls it back if they aren't running in time.
+// Returned rollout is empty if the service is healthy.
+func (h *SwarmServiceHandler) ensureHealthy(before swarm.Service, image string, policy rollbackPolicy) (rollout, error) {
+	defer inFlightDeploys.start("checking %s health", before.Spec.Name)()
+	cli, err := docker.NewEnvClient()
+	if err != nil {
+		return rollout{}, fmt.Errorf("can't connect to docker host: %s", err)
+	}
+	defer withouterrIOClose(cli)
+
+	ctx, cancel := context.WithTimeout(context.Background(), policy.deadline())
+	defer cancel()
+	reason, healthy := waitForNewTasks(ctx, cli, before, image, h.config.Convergence.pollInterval())
+	if healthy {
+		return rollout{}, nil
+	}
+
+	result := rollout{
+		State:      rolloutStateRolledBack,
+		Message:    fmt.Sprintf("new tasks aren't running in %s: %s", policy.deadline(), reason),
+		TaskErrors: failedTasks(cli, before),
+	}
+	Logz("rolling back %s, %s %v", before.Spec.Name, result.Message, result.TaskErrors)
+	if err := rollbackService(cli, before.ID); err != nil {
+		return result, fmt.Errorf("rollback of %s failed: %s, rollback reason: %s", before.Spec.Name, err, result.Message)
+	}
+	return result, nil
+}
+
+// waitForNewTasks - true when all desired tasks run the new image, else the reason why not
+func waitForNewTasks(ctx context.Context, cli *docker.Client, before swarm.Service, image string, interval time.Duration) (string, bool) {
+	reason := "tasks weren't checked"
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		tasks, err := cli.TaskList(ctx, types.TaskListOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("service", before.ID),
+				filters.Arg("desired-state", string(swarm.TaskStateRunning)),
+			),
+		})
+		if err == nil {
+			var running, desired int
+			running, desired, reason = countNewTasks(tasks, before, image)
+			// a service scaled to zero has nothing to wait for
+			if running >= desired {
+				return "", true
+			}
+		} else if ctx.Err() == nil {
+			reason = fmt.Sprintf("can't list tasks: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return reason, false
+		case <-ticker.C:
+		}
+	}
+}
+
+func countNewTasks(tasks []swarm.Task, before swarm.Service, image string) (running, desired int, reason string) {
+	desired = len(tasks)
+	if replicated := before.Spec.Mode.Replicated; replicated != nil && replicated.Replicas != nil {
+		desired = int(*replicated.Replicas)
+	}
+	for _, task := range tasks {
+		spec := task.Spec.ContainerSpec
+		// tasks of the previous spec may run the same tag with an older digest,
+		// only tasks created after the update was submitted are new
+		if spec == nil || !task.CreatedAt.After(before.UpdatedAt) || task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+		// swarm may append @sha256:... to the image
+		if spec.Image == image || strings.HasPrefix(spec.Image, image+"@") {
+			running++
+		}
+	}
+	return running, desired, fmt.Sprintf("%d/%d new tasks running", running, desired)
+}
+
+// updateStarted - re-inspects the service after ServiceUpdate. Swarm keeps the spec and starts
+// no update if the image stayed the same, e.g. a duplicate hook for the image the service runs:
+// with QueryRegistry the engine pins the tag to the digest it resolved, the one already running.
+func updateStarted(before swarm.Service) bool {
+	cli, err := docker.NewEnvClient()
+	if err != nil {
+		Logz("can't connect to docker host: %s", err)
+		return true
+	}
+	defer withouterrIOClose(cli)
+	after, _, err := cli.ServiceInspectWithRaw(context.Background(), before.ID, types.ServiceInspectOptions{})
+	if err != nil {
+		Logz("can't inspect %s after the update: %s", before.Spec.Name, err)
+		return true
+	}
+	image := containerImage(after)
+	if image == containerImage(before) {
+		Logz("%s already runs %s, swarm starts no update", before.Spec.Name, image)
+		return false
+	}
+	return true
+}
+
+func containerImage(service swarm.Service) string {
+	if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		return spec.Image
+	}
+	return ""
+}
+
+func rollbackService(cli *docker.Client, serviceID string) error {
+	ctx := context.Background()
+	service, _, err := cli.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+	if err != nil {
+		return err
+	}
+	_, err = cli.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, types.ServiceUpdateOptions{Rollback: "previous"})
+	return err
+}
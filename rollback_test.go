@@ -0,0 +1,212 @@
+package main
+
+import (
+	"docker.io/go-docker/api/types/swarm"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeTasksBody = `[
+	{"ID": "1", "CreatedAt": "2018-09-23T10:00:01Z", "DesiredState": "running", "Spec": {"ContainerSpec": {"Image": "docker-registry.private-host.com/projectq-app:latest@sha256:791de1ee1a11"}}, "Status": {"State": "running"}},
+	{"ID": "2", "CreatedAt": "2018-09-23T10:00:02Z", "DesiredState": "running", "Spec": {"ContainerSpec": {"Image": "docker-registry.private-host.com/projectq-app:latest@sha256:791de1ee1a11"}}, "Status": {"State": "%s", "Err": "%s"}}
+]`
+
+func TestSwarmRollbackPolicy(t *testing.T) {
+	config := testConfig
+	config.Rollback = map[string]rollbackPolicy{
+		"projectq-stack-latest_backend": {Deadline: duration{20 * time.Millisecond}},
+	}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	rollbackErr := "projectq-stack-latest_backend rolled back: new tasks aren't running in 20ms: 1/2 new tasks running"
+	cases := []Case{
+		{ // case 0: all new tasks are running
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusOK,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, fakeServiceRunning(fakeOldImage)},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, fakeServiceRunning(fakeNewImage)},
+				{http.StatusOK, []byte(fmt.Sprintf(fakeTasksBody, "running", ""))},
+			},
+			Result: CR{
+				"status": "OK",
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "docker-registry.private-host.com/projectq-app:latest",
+					"status":  "OK",
+				}},
+			},
+		},
+		{ // case 1: the 2nd task never starts
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusBadRequest,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, fakeServiceRunning(fakeOldImage)},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, fakeServiceRunning(fakeNewImage)},
+				{http.StatusOK, []byte(fmt.Sprintf(fakeTasksBody, "starting", ""))},
+				{http.StatusOK, []byte(fmt.Sprintf(fakeTasksBody, "failed", "task: non-zero exit (1)"))},
+				{http.StatusOK, []byte(fakeServiceInspectBody)},
+				{http.StatusOK, []byte(`{}`)},
+			},
+			Result: CR{
+				"error": rollbackErr,
+				"services": []CR{{
+					"service":     "projectq-stack-latest_backend",
+					"image":       "docker-registry.private-host.com/projectq-app:latest",
+					"status":      "FAILED",
+					"error":       rollbackErr,
+					"state":       "rolled_back",
+					"task_errors": []string{"task 2: failed: task: non-zero exit (1)"},
+				}},
+			},
+		},
+	}
+
+	// the old tasks run the pushed tag with an older digest, the new ones never start
+	oldTasks := fmt.Sprintf(`[
+		{"ID": "0", "CreatedAt": "2018-09-22T10:00:01Z", "DesiredState": "running", "Spec": {"ContainerSpec": {"Image": "%s"}}, "Status": {"State": "running"}},
+		{"ID": "1", "CreatedAt": "2018-09-22T10:00:02Z", "DesiredState": "running", "Spec": {"ContainerSpec": {"Image": "%s"}}, "Status": {"State": "running"}}
+	]`, fakeOldImage, fakeOldImage)
+	staleErr := "projectq-stack-latest_backend rolled back: new tasks aren't running in 20ms: 0/2 new tasks running"
+	cases = []Case{
+		{ // case 0: the re-pushed tag is never picked up
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusBadRequest,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, fakeServiceRunning(fakeOldImage)},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, fakeServiceRunning(fakeNewImage)},
+				{http.StatusOK, []byte(oldTasks)},
+				{http.StatusOK, []byte(oldTasks)},
+				{http.StatusOK, []byte(fakeServiceInspectBody)},
+				{http.StatusOK, []byte(`{}`)},
+			},
+			Result: CR{
+				"error": staleErr,
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "docker-registry.private-host.com/projectq-app:latest",
+					"status":  "FAILED",
+					"error":   staleErr,
+					"state":   "rolled_back",
+				}},
+			},
+		},
+	}
+
+	runTests(t, ts, cases, config)
+
+	// a digest-less hook for the image the service already runs: swarm keeps the spec
+	// and starts no tasks, the service must not be rolled back
+	config.Services = map[string]serviceList{"quay.io/vorona/app:latest": {"projectq-stack-latest_backend"}}
+	ts = httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+	quayRunning := fakeServiceRunning("quay.io/vorona/app:latest@sha256:791de1ee1a11")
+	scaledToZero := []byte(strings.Replace(string(fakeServiceRunning("quay.io/vorona/app:latest@sha256:0123")), `"Replicas":2`, `"Replicas":0`, 1))
+	cases = []Case{
+		{ // case 0: duplicate hook
+			Path:    APIEndpointWebHookQuay,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusOK,
+			Payload: `{"docker_url": "quay.io/vorona/app", "updated_tags": ["latest"]}`,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, quayRunning},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, quayRunning},
+			},
+			Result: CR{
+				"status": "OK",
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "quay.io/vorona/app:latest",
+					"status":  "OK",
+				}},
+			},
+		},
+		{ // case 1: the service is scaled to zero, there are no tasks to wait for
+			Path:    APIEndpointWebHookQuay,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusOK,
+			Payload: `{"docker_url": "quay.io/vorona/app", "updated_tags": ["latest"]}`,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{http.StatusOK, scaledToZero},
+				{http.StatusOK, []byte(`{}`)},
+				{http.StatusOK, quayRunning},
+				{http.StatusOK, []byte(`[]`)},
+			},
+			Result: CR{
+				"status": "OK",
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "quay.io/vorona/app:latest",
+					"status":  "OK",
+				}},
+			},
+		},
+	}
+	runTests(t, ts, cases, config)
+}
+
+func TestCountNewTasks(t *testing.T) {
+	updatedAt := time.Date(2018, 9, 22, 16, 51, 58, 0, time.UTC)
+	before := swarm.Service{Meta: swarm.Meta{UpdatedAt: updatedAt}}
+	task := func(image string, created time.Time) swarm.Task {
+		return swarm.Task{
+			Meta:   swarm.Meta{CreatedAt: created},
+			Spec:   swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: image}},
+			Status: swarm.TaskStatus{State: swarm.TaskStateRunning},
+		}
+	}
+	old, updated := updatedAt.Add(-time.Hour), updatedAt.Add(time.Second)
+
+	cases := []struct {
+		image   string
+		tasks   []swarm.Task
+		running int
+	}{
+		{"app:latest", []swarm.Task{task("app:latest@sha256:0123", old), task("app:latest@sha256:0123", old)}, 0},
+		{"app:latest", []swarm.Task{task("app:latest@sha256:4567", updated), task("app:latest@sha256:0123", old)}, 1},
+		{"app:latest", []swarm.Task{task("app:latest", updated), task("app:latest@sha256:4567", updated)}, 2},
+		{"app:1", []swarm.Task{task("app:10@sha256:4567", updated), task("app:1@sha256:4567", updated)}, 1},
+		{"app:1@sha256:4567", []swarm.Task{task("app:1@sha256:4567", updated), task("app:1@sha256:0123", updated)}, 1},
+	}
+	for i, c := range cases {
+		if running, _, _ := countNewTasks(c.tasks, before, c.image); running != c.running {
+			t.Errorf("case %d: expected %d running, got %d", i, c.running, running)
+		}
+	}
+}
+
+func TestCountNewTasksGlobalMode(t *testing.T) {
+	before := swarm.Service{Spec: swarm.ServiceSpec{Mode: swarm.ServiceMode{Global: &swarm.GlobalService{}}}}
+	created := swarm.Meta{CreatedAt: time.Now()}
+	tasks := []swarm.Task{
+		{Meta: created, Spec: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "app:latest@sha256:0123"}}, Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+		{Meta: created, Spec: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "app:previous"}}, Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+		{Spec: swarm.TaskSpec{}},
+	}
+	if running, desired, _ := countNewTasks(tasks, before, "app:latest"); running != 1 || desired != 3 {
+		t.Errorf("expected 1/3, got %d/%d", running, desired)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+)
+
+// serviceQueue - serializes updates of the same service.
+// One update runs and at most one waits, a newer update supersedes the waiting one,
+// so the newest image wins. Updates of different services don't wait for each other.
+type serviceQueue struct {
+	mu      sync.Mutex
+	running map[string]bool
+	pending map[string]chan bool
+}
+
+var serviceDeploys = newServiceQueue()
+
+func newServiceQueue() *serviceQueue {
+	return &serviceQueue{
+		running: map[string]bool{},
+		pending: map[string]chan bool{},
+	}
+}
+
+// acquire - blocks until the service is free, returns false if a newer update superseded this one
+func (q *serviceQueue) acquire(service string) bool {
+	q.mu.Lock()
+	if !q.running[service] {
+		q.running[service] = true
+		q.mu.Unlock()
+		return true
+	}
+	if older, ok := q.pending[service]; ok {
+		older <- false
+	}
+	ready := make(chan bool, 1)
+	q.pending[service] = ready
+	q.mu.Unlock()
+	return <-ready
+}
+
+// release - hands the service over to the waiting update, if any
+func (q *serviceQueue) release(service string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if next, ok := q.pending[service]; ok {
+		delete(q.pending, service)
+		next <- true
+		return
+	}
+	delete(q.running, service)
+}
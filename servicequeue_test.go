@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceQueueSupersede(t *testing.T) {
+	q := newServiceQueue()
+	if !q.acquire("web") {
+		t.Fatalf("free service must be acquired")
+	}
+	if !q.acquire("worker") {
+		t.Fatalf("other services must not wait")
+	}
+
+	older := make(chan bool)
+	newer := make(chan bool)
+	go func() { older <- q.acquire("web") }()
+	time.Sleep(10 * time.Millisecond)
+	go func() { newer <- q.acquire("web") }()
+
+	if <-older {
+		t.Errorf("waiting update must be superseded by the newer one")
+	}
+	select {
+	case <-newer:
+		t.Fatalf("newer update must wait for the running one")
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.release("web")
+	if !<-newer {
+		t.Errorf("newer update must run after release")
+	}
+	q.release("web")
+	q.release("worker")
+	if len(q.running) != 0 || len(q.pending) != 0 {
+		t.Errorf("queue must be empty, got %v %v", q.running, q.pending)
+	}
+}
@@ -1,18 +1,131 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const byebyeMessage = "BYE-BYE!"
 const shutdownEnpoint = "/shutdown"
+const defaultShutdownTimeout = 30 * time.Second
+
+// shutdownConfig - /shutdown endpoint settings
+type shutdownConfig struct {
+	Disabled   bool
+	AdminToken string   // "Authorization: Bearer <AdminToken>", the webhook auth is used when it's empty
+	Timeout    duration // how long in-flight requests and deploys are drained, default 30s
+}
+
+func (c *shutdownConfig) timeout() time.Duration {
+	if c.Timeout.Duration > 0 {
+		return c.Timeout.Duration
+	}
+	return defaultShutdownTimeout
+}
+
+// gracefulServer - http.Server which is stopped only once and drains in-flight requests
+type gracefulServer struct {
+	*http.Server
+	once sync.Once
+	done chan struct{}
+}
+
+func newGracefulServer(s *http.Server) *gracefulServer {
+	return &gracefulServer{Server: s, done: make(chan struct{})}
+}
+
+// drain - stops accepting new requests and waits up to timeout for requests in flight
+func (g *gracefulServer) drain(timeout time.Duration) {
+	g.once.Do(func() {
+		go func() {
+			defer close(g.done)
+			Logz("shutting down, draining requests in flight for up to %s", timeout)
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := g.Shutdown(ctx); err != nil {
+				Logz("graceful shutdown failed: %s", err)
+				withouterrIOClose(g.Server)
+			}
+			if interrupted := inFlightDeploys.wait(ctx); len(interrupted) > 0 {
+				Logz("shutdown timeout, %d deploys interrupted: %s", len(interrupted), strings.Join(interrupted, "; "))
+				return
+			}
+			Logz("all deploys finished, bye")
+		}()
+	})
+}
+
+// drainOnSignal - starts drain on SIGTERM or SIGINT, timeout is read when the signal comes.
+// Returned func stops listening for signals.
+func (g *gracefulServer) drainOnSignal(timeout func() time.Duration) func() {
+	sigs := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case sig := <-sigs:
+			Logz("got signal %s", sig)
+			g.drain(timeout())
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// wait - blocks until drain is finished
+func (g *gracefulServer) wait() {
+	<-g.done
+}
 
 type shutdownHandler struct {
-	server *http.Server
+	server  *gracefulServer
+	handler *reloadableHandler
 }
 
 func (h *shutdownHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current := h.handler.load()
+	config := current.config.Shutdown
+	if config.Disabled || !current.config.shutdownSecured() {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"bad method"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, `{"error": "can't read payload"}`, http.StatusBadRequest)
+		return
+	}
+	if !adminAuthorized(r, config.AdminToken) && !(config.AdminToken == "" && current.authorized(r, body)) {
+		http.Error(w, `{"error": "unauthorized"}`, http.StatusForbidden)
+		return
+	}
 
-	go withouterrIOClose(h.server)
+	h.server.drain(config.timeout())
 	wWrite(w, []byte(byebyeMessage))
 }
+
+// shutdownSecured - false if nothing but provider specific auth is configured,
+// /shutdown?key= with the empty key would stop the webhook for anyone then
+func (c *mainConfig) shutdownSecured() bool {
+	return c.Shutdown.AdminToken != "" || c.Signature.enabled() || c.APISecretKey != ""
+}
+
+func adminAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
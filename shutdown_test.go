@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownHandlerAuth(t *testing.T) {
+	adminConfig := testConfig
+	adminConfig.Shutdown = shutdownConfig{AdminToken: "Ohmeir4ahh0o"}
+	disabledConfig := testConfig
+	disabledConfig.Shutdown = shutdownConfig{Disabled: true}
+	// provider specific auth only, no AdminToken, Signature or key
+	unsecuredConfig := testConfig
+	unsecuredConfig.APISecretKey = ""
+	unsecuredConfig.GitHub = gitHubConfig{Secret: "GithubSecretChangeME"}
+
+	keyQuery := fmt.Sprintf("%s=%s", APIWebHookKeyName, testConfig.APISecretKey)
+	cases := []struct {
+		config  mainConfig
+		method  string
+		query   string
+		headers map[string]string
+		status  int
+	}{
+		{testConfig, http.MethodGet, keyQuery, nil, http.StatusMethodNotAllowed},
+		{testConfig, http.MethodPost, "", nil, http.StatusForbidden},
+		{testConfig, http.MethodPost, APIWebHookKeyName + "=fake", nil, http.StatusForbidden},
+		{testConfig, http.MethodPost, keyQuery, nil, http.StatusOK},
+		{adminConfig, http.MethodPost, keyQuery, nil, http.StatusForbidden},
+		{adminConfig, http.MethodPost, "", map[string]string{"Authorization": "Bearer fake"}, http.StatusForbidden},
+		{adminConfig, http.MethodPost, "", map[string]string{"Authorization": "Bearer Ohmeir4ahh0o"}, http.StatusOK},
+		{disabledConfig, http.MethodPost, keyQuery, nil, http.StatusNotFound},
+		{unsecuredConfig, http.MethodPost, APIWebHookKeyName + "=", nil, http.StatusNotFound},
+		{unsecuredConfig, http.MethodPost, "", nil, http.StatusNotFound},
+	}
+	for idx, c := range cases {
+		gs := newGracefulServer(&http.Server{})
+		h := &shutdownHandler{gs, newReloadableHandler(&SwarmServiceHandler{c.config, testUpdateOpts})}
+		r := httptest.NewRequest(c.method, shutdownEnpoint+"?"+c.query, nil)
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("case %d: expected status %d, got %d", idx, c.status, w.Code)
+		}
+		if c.status == http.StatusOK {
+			// drained server is closed only once
+			gs.drain(0)
+			gs.wait()
+		}
+	}
+}
+
+func TestShutdownOnSIGTERM(t *testing.T) {
+	if err := os.Setenv(configENVName, convertInterfaceToBase64String(testConfig)); err != nil {
+		t.Errorf("can't set OS environ with error: %s", err)
+	}
+	stopped := make(chan errExt)
+	go func() {
+		_, errS := startService("127.0.0.1:9877")
+		stopped <- errS
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("can't send signal: %s", err)
+	}
+	select {
+	case errS := <-stopped:
+		if errS.Err != nil {
+			t.Errorf("unexpected error: %v", errS)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("service wasn't stopped by SIGTERM")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"docker.io/go-docker"
 	"docker.io/go-docker/api/types"
@@ -11,12 +12,33 @@ import (
 	"fmt"
 	"github.com/docker/distribution/notifications"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 )
 
-var allowedWebHookEndpoints = map[string]bool{
-	APIEndpointWebHookRegistry:  true,
-	APIEndpointWebHookDockerHub: true,
+// webhookSource - payload parser and authentication of a webhook endpoint
+type webhookSource struct {
+	parse func(h *SwarmServiceHandler, header http.Header, body io.Reader) (hookPayload, error)
+	// authorize - own authentication of the source (tokens, signatures), nil means ?key= or Signature
+	authorize func(c *mainConfig, r *http.Request, body []byte) error
+}
+
+var webhookSources = map[string]webhookSource{
+	APIEndpointWebHookRegistry:    {(*SwarmServiceHandler).registryPayload, nil},
+	APIEndpointWebHookDockerHub:   {(*SwarmServiceHandler).dockerHubPayload, nil},
+	APIEndpointWebHookGitHub:      {(*SwarmServiceHandler).gitHubPayload, authorizeGitHub},
+	APIEndpointWebHookGitLab:      {(*SwarmServiceHandler).gitLabPayload, authorizeGitLab},
+	APIEndpointWebHookHarbor:      {(*SwarmServiceHandler).harborPayload, authorizeHarbor},
+	APIEndpointWebHookQuay:        {(*SwarmServiceHandler).quayPayload, nil},
+	APIEndpointWebHookArtifactory: {(*SwarmServiceHandler).artifactoryPayload, authorizeArtifactory},
+	APIEndpointWebHookNexus:       {(*SwarmServiceHandler).nexusPayload, authorizeNexus},
+	APIEndpointWebHookECR:         {(*SwarmServiceHandler).ecrPayload, authorizeECR},
+	APIEndpointWebHookGCR:         {(*SwarmServiceHandler).gcrPayload, authorizeGCR},
+	APIEndpointWebHookACR:         {(*SwarmServiceHandler).acrPayload, authorizeACR},
+	APIEndpointWebHookGitea:       {(*SwarmServiceHandler).giteaPayload, authorizeGitea},
+	APIEndpointWebHookCloudEvents: {(*SwarmServiceHandler).cloudEventsPayload, nil},
 }
 
 // DockerHubPayload - payload from docker registry webhook service
@@ -32,88 +54,242 @@ type DockerHubPayload struct {
 // DockerRegistryV2Payload - payload from docker registry webhook service
 type DockerRegistryV2Payload map[string][]notifications.Event
 
-func (h *SwarmServiceHandler) updateService(params HookParamsFromPayload) error {
+// deploySuperseded - the update was skipped, a newer hook for the same service came while it waited
+const deploySuperseded = "SUPERSEDED"
+
+// deployResult - outcome of updating one swarm service
+type deployResult struct {
+	Service  string   `json:"service"`
+	Image    string   `json:"image"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	// rollout outcome, only when Convergence or Rollback is enabled
+	State      string   `json:"state,omitempty"`
+	TaskErrors []string `json:"task_errors,omitempty"`
+}
+
+// deployTargets - deploys every target, results are merged into one list
+func (h *SwarmServiceHandler) deployTargets(targets []HookParamsFromPayload) ([]deployResult, error) {
+	var results []deployResult
+	var errs []string
+	for _, params := range targets {
+		targetResults, err := h.deployServices(params)
+		results = append(results, targetResults...)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return results, errors.New(strings.Join(errs, "; "))
+	}
+	return results, nil
+}
+
+// deployServices - updates every service from params, one failed service doesn't stop the others
+func (h *SwarmServiceHandler) deployServices(params HookParamsFromPayload) ([]deployResult, error) {
+	results := make([]deployResult, 0, len(params.serviceNames))
+	var errs []string
+	var errDigest error
+	if h.config.PinDigest && params.digest == "" {
+		// resolve once, so every service gets the same artifact
+		params.digest, errDigest = h.resolveDigest(params.registryImage)
+	}
+	for _, serviceName := range params.serviceNames {
+		result := deployResult{Service: serviceName, Image: params.registryImage, Status: "OK"}
+		err := errDigest
+		if err == nil {
+			err = h.deployService(params, serviceName, &result)
+		}
+		if err != nil {
+			result.Status = "FAILED"
+			result.Error = err.Error()
+			errs = append(errs, result.Error)
+		}
+		results = append(results, result)
+	}
+	if len(errs) > 0 {
+		return results, errors.New(strings.Join(errs, "; "))
+	}
+	return results, nil
+}
+
+// deployService - updates the service and waits for rollout if Convergence is enabled.
+// Updates of the same service are serialized, see serviceQueue.
+func (h *SwarmServiceHandler) deployService(params HookParamsFromPayload, serviceName string, result *deployResult) error {
+	if !serviceDeploys.acquire(serviceName) {
+		Logz("%s => %s superseded by a newer hook", params.registryImage, serviceName)
+		result.Status = deploySuperseded
+		return nil
+	}
+	defer serviceDeploys.release(serviceName)
+
+	before, warnings, err := h.updateService(params, serviceName)
+	result.Warnings = warnings
+	if err != nil {
+		return err
+	}
+	policy, rollback := h.config.Rollback[serviceName]
+	if !rollback && !h.config.Convergence.Enabled {
+		return nil
+	}
+	// without a new spec there are neither new tasks to check nor a rollout to wait for
+	if !updateStarted(before) {
+		if h.config.Convergence.Enabled {
+			result.State = string(swarm.UpdateStateCompleted)
+		}
+		return nil
+	}
+	if rollback {
+		state, err := h.ensureHealthy(before, h.deployImage(params), policy)
+		if state.State != "" {
+			result.State, result.TaskErrors = state.State, state.TaskErrors
+		}
+		if err != nil {
+			return err
+		}
+		if state.State == rolloutStateRolledBack {
+			return fmt.Errorf("%s rolled back: %s", serviceName, state.Message)
+		}
+	}
+	if !h.config.Convergence.Enabled {
+		return nil
+	}
+	state, err := h.waitForConvergence(before)
+	if err != nil {
+		return err
+	}
+	result.State, result.TaskErrors = state.State, state.TaskErrors
+	if !state.succeeded() {
+		return fmt.Errorf("rollout of %s %s: %s", serviceName, state.State, state.Message)
+	}
+	return nil
+}
+
+// deployImage - image reference which goes to the service spec
+func (h *SwarmServiceHandler) deployImage(params HookParamsFromPayload) string {
+	if h.config.PinDigest {
+		return pinnedImage(params.registryImage, params.digest)
+	}
+	return params.registryImage
+}
+
+// updateService - submits the new image, returns the service inspected before the update and docker warnings
+func (h *SwarmServiceHandler) updateService(params HookParamsFromPayload, serviceName string) (swarm.Service, []string, error) {
 	// Logz("Starting update service with values: %+v\n", params)
 	// TODO: need separate func for validate params
-	if len(params.serviceName)*len(params.registryImage) == 0 {
-		return fmt.Errorf("nothing to do, exit. SN: %s IMG: %s", params.serviceName, params.registryImage)
+	if len(serviceName)*len(params.registryImage) == 0 {
+		return swarm.Service{}, nil, fmt.Errorf("nothing to do, exit. SN: %s IMG: %s", serviceName, params.registryImage)
 	}
+	defer inFlightDeploys.start("%s => %s", params.registryImage, serviceName)()
+
+	attempts := h.config.Retry.attempts()
+	for attempt := 1; ; attempt++ {
+		// every attempt inspects the service again, so it gets the current version
+		service, warnings, err := h.tryUpdateService(params, serviceName)
+		if err == nil {
+			return service, warnings, nil
+		}
+		reason := retryReason(err)
+		if reason == "" {
+			Logz("attempt %d/%d to update %s failed (not retriable): %s", attempt, attempts, serviceName, err)
+			return service, warnings, err
+		}
+		if attempt >= attempts {
+			Logz("attempt %d/%d to update %s failed (%s): %s, giving up", attempt, attempts, serviceName, reason, err)
+			return service, warnings, err
+		}
+		delay := h.config.Retry.backoff(attempt)
+		Logz("attempt %d/%d to update %s failed (%s): %s, retrying in %s", attempt, attempts, serviceName, reason, err, delay)
+		time.Sleep(delay)
+	}
+}
+
+func (h *SwarmServiceHandler) tryUpdateService(params HookParamsFromPayload, serviceName string) (swarm.Service, []string, error) {
 	ctx := context.Background()
 
 	if cli, err := docker.NewEnvClient(); err == nil {
 		defer withouterrIOClose(cli)
 		if service, _, errCliService := cli.ServiceInspectWithRaw(
-			ctx, params.serviceName, types.ServiceInspectOptions{}); errCliService == nil {
-			spec := &service.Spec
-			spec.TaskTemplate.ContainerSpec.Image = params.registryImage
+			ctx, serviceName, types.ServiceInspectOptions{}); errCliService == nil {
+			// ContainerSpec is a pointer, it's copied so service keeps the image it ran before the update
+			spec := service.Spec
+			containerSpec := *spec.TaskTemplate.ContainerSpec
+			containerSpec.Image = h.deployImage(params)
+			spec.TaskTemplate.ContainerSpec = &containerSpec
 			if respServiceUpdate, errCliServiceUpd := cli.ServiceUpdate(
 				ctx,
 				service.ID,
 				swarm.Version{Index: service.Version.Index},
-				*spec,
+				spec,
 				h.updateOpts); errCliServiceUpd == nil {
 				Logz("Update warnings: %s", respServiceUpdate.Warnings)
-				message := "SERVICE UPDATED - " + params.serviceName + " " + service.ID
+				message := "SERVICE UPDATED - " + serviceName + " " + service.ID
 				Logz(message)
+				return service, respServiceUpdate.Warnings, nil
 			} else {
-				return fmt.Errorf("updating a service: %s, %s", service.ID, errCliServiceUpd)
+				return swarm.Service{}, nil, &updateError{fmt.Sprintf("updating a service: %s, %s", service.ID, errCliServiceUpd), errCliServiceUpd}
 			}
 		} else {
-			return fmt.Errorf("can't connect to service %s: %s", params.serviceName, errCliService)
+			return swarm.Service{}, nil, &updateError{fmt.Sprintf("can't connect to service %s: %s", serviceName, errCliService), errCliService}
 		}
 	} else {
-		return fmt.Errorf("can't connect to docker host: %s", err)
+		return swarm.Service{}, nil, fmt.Errorf("can't connect to docker host: %s", err)
 	}
-	return nil
 }
 
-func (h *SwarmServiceHandler) getHookParamsFromPayload(body io.Reader, endpoint string) (HookParamsFromPayload, error) {
-	var params HookParamsFromPayload
-
-	if endpoint == APIEndpointWebHookRegistry {
-		payload := DockerRegistryV2Payload{}
-		decoder := json.NewDecoder(body)
-		if err := decoder.Decode(&payload); err != nil {
-			return params, err
-		}
-
-		//decoder := json.NewDecoder(body)
-		//if err := decoder.Decode(&payload); err != nil {
-		//	return params, err
-		//}
-		if events := payload["events"]; len(events) > 0 {
-			firstEvent := events[0]
-			if firstEvent.Action == "pull" {
-				return params, errors.New("PULL is an excluded method")
-			}
-			Logz("Got payload from %s: %+v", APIEndpointWebHookRegistry, payload)
-			params.registryImage = firstEvent.Request.Host + "/" + firstEvent.Target.Repository + ":" + firstEvent.Target.Tag
-			params.serviceName = h.config.Services[params.registryImage]
-			return params, nil
-		}
-		return params, errors.New("payload without events")
+func (h *SwarmServiceHandler) getHookParamsFromPayload(body io.Reader, endpoint string, header http.Header) (hookPayload, error) {
+	source, ok := h.sourceFor(endpoint)
+	if !ok {
+		return hookPayload{}, errors.New("invalid endpoint")
 	}
+	return source.parse(h, header, body)
+}
 
-	if endpoint == APIEndpointWebHookDockerHub {
-		payload := DockerHubPayload{}
-		decoder := json.NewDecoder(body)
-		if err := decoder.Decode(&payload); err != nil {
-			return params, err
-		}
-		Logz("Got payload from %s: %+v", APIEndpointWebHookDockerHub, payload)
-		params.registryImage = payload.Repository.RepoName + ":" + payload.PushData.Tag
-		params.serviceName = h.config.Services[params.registryImage]
-		return params, nil
+// sourceFor - webhook source of the endpoint, generic sources are looked up in the config
+func (h *SwarmServiceHandler) sourceFor(endpoint string) (webhookSource, bool) {
+	if source, ok := webhookSources[endpoint]; ok {
+		return source, true
 	}
+	return h.config.genericWebhookSource(endpoint)
+}
 
-	return HookParamsFromPayload{}, errors.New("invalid endpoint")
+func (h *SwarmServiceHandler) registryPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	payload := DockerRegistryV2Payload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	events := payload["events"]
+	if len(events) == 0 {
+		return result, errors.New("payload without events")
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookRegistry, payload)
+	h.addRegistryEvents(&result, events)
+	return result, nil
+}
 
+func (h *SwarmServiceHandler) dockerHubPayload(header http.Header, body io.Reader) (hookPayload, error) {
+	var result hookPayload
+	var params HookParamsFromPayload
+	payload := DockerHubPayload{}
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&payload); err != nil {
+		return result, err
+	}
+	Logz("Got payload from %s: %+v", APIEndpointWebHookDockerHub, payload)
+	params.registryImage = payload.Repository.RepoName + ":" + payload.PushData.Tag
+	params.serviceNames = h.config.servicesFor(params.registryImage)
+	result.add(params)
+	return result, nil
 }
 
 // HookParamsFromPayload - golint
 type HookParamsFromPayload struct {
 	registryImage string
-	serviceName   string
+	digest        string // sha256:... if payload has it
+	serviceNames  []string
 }
 
 // SwarmServiceHandler - main http handler
@@ -123,47 +299,29 @@ type SwarmServiceHandler struct {
 }
 
 func (h *SwarmServiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	Logz("%s %s %s %s %s %v\n", r.Method, r.RequestURI, r.Proto, r.RemoteAddr, r.Host, r.ContentLength)
+	Logz("%s %s %s %s %s %v\n", r.Method, redactedRequestURI(r), r.Proto, r.RemoteAddr, r.Host, r.ContentLength)
 	if r.Method == "POST" {
-		if allowedWebHookEndpoints[r.URL.Path] {
-			values := r.URL.Query()
-			keys := values[APIWebHookKeyName]
-			if len(keys) > 0 {
-				if key := keys[0]; key == h.config.APISecretKey {
-					// do your staff here
-					plParams, err := h.getHookParamsFromPayload(r.Body, r.URL.Path)
-					if err != nil {
-						w.WriteHeader(http.StatusBadRequest)
-						data := withouterrJSONMarshal(CR{
-							"error": "can't decode payload: " + err.Error(),
-						})
-						wWrite(w, data)
-						return
-					}
-					Logz("%+v", plParams)
-					if plParams.serviceName == "" {
-						// we have to response with 2xx code here, because of error:
-						// retryingsink: error writing events: httpSink{http://callback.url}: response status 400 Bad Request unaccepted, retrying
-						w.WriteHeader(http.StatusOK)
-						resp := withouterrJSONMarshal(CR{
-							"error": fmt.Sprintf("empty ServiceName, exit. IMG: %s", plParams.registryImage),
-						})
-						wWrite(w, resp)
-						return
-					}
-					// UPDATING SERVICE:
-					if err := h.updateService(plParams); err == nil {
-						w.WriteHeader(http.StatusOK)
-						wWrite(w, []byte(`{"status": "OK"}`))
-					} else {
-						w.WriteHeader(http.StatusBadRequest)
-						data := withouterrJSONMarshal(CR{
-							"error": err.Error(),
-						})
-						wWrite(w, data)
-					}
+		if source, ok := h.sourceFor(r.URL.Path); ok {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, `{"error": "can't read payload"}`, http.StatusBadRequest)
+				return
+			}
+			if h.authorizedSource(source, r, body) {
+				// do your staff here
+				payload, err := h.getHookParamsFromPayload(bytes.NewReader(body), r.URL.Path, r.Header)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					data := withouterrJSONMarshal(CR{
+						"error": "can't decode payload: " + err.Error(),
+					})
+					wWrite(w, data)
 					return
 				}
+				payload.ignoreUnmapped()
+				Logz("%+v", payload)
+				h.deployPayload(w, payload)
+				return
 			}
 			http.Error(w, `{"error": "unauthorized"}`, http.StatusForbidden)
 		} else {
@@ -175,6 +333,47 @@ func (h *SwarmServiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// deployPayload - deploys targets of the payload (or queues them) and writes the response
+func (h *SwarmServiceHandler) deployPayload(w http.ResponseWriter, payload hookPayload) {
+	if len(payload.targets) == 0 {
+		// we have to response with 2xx code here, because of error:
+		// retryingsink: error writing events: httpSink{http://callback.url}: response status 400 Bad Request unaccepted, retrying
+		w.WriteHeader(http.StatusOK)
+		wWrite(w, withouterrJSONMarshal(payload.response(CR{
+			"error": "nothing to deploy",
+		})))
+		return
+	}
+	if h.config.AsyncDeploy {
+		job, err := deployJobs.submit(h, payload.targets)
+		if err != nil {
+			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		wWrite(w, withouterrJSONMarshal(payload.response(CR{
+			"status": job.Status,
+			"job":    job.ID,
+			"url":    jobsEndpoint + job.ID,
+		})))
+		return
+	}
+	// UPDATING SERVICES:
+	if results, err := h.deployTargets(payload.targets); err == nil {
+		w.WriteHeader(http.StatusOK)
+		wWrite(w, withouterrJSONMarshal(payload.response(CR{
+			"status":   "OK",
+			"services": results,
+		})))
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		wWrite(w, withouterrJSONMarshal(payload.response(CR{
+			"error":    err.Error(),
+			"services": results,
+		})))
+	}
+}
+
 func createBase64AuthData(config types.AuthConfig) string {
 	var authBase64 string
 	if config.Username != "" && config.Password != "" {
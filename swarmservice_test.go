@@ -11,7 +11,10 @@ import (
 	"time"
 )
 
-const dockerSimpleSocket = "/tmp/echo.sock"
+const (
+	dockerSimpleSocket     = "/tmp/echo.sock"
+	fakeServiceInspectBody = `{"ID":"knmtuvl25atbbpmsra8yl6daz","Version":{"Index":92917},"CreatedAt":"2018-09-15T21:53:48.33970499Z","UpdatedAt":"2018-09-22T16:51:58.819201217Z","Spec":{"Name":"projectq-stack-latest_backend","Labels":{"com.docker.stack.image":"docker-registry.private-host.com/projectq-app","com.docker.stack.namespace":"projectq-stack-latest","traefik.backend":"app","traefik.backend.loadbalancer.swarm":"true","traefik.docker.network":"web","traefik.enable":"true","traefik.frontend.passHostHeader":"true","traefik.frontend.rule":"Host:projectq-002.private-host.com","traefik.port":"8000","traefik.protocol":"http"},"TaskTemplate":{"ContainerSpec":{"Image":"docker-registry.private-host.com/projectq-app:latest","Labels":{"com.docker.stack.namespace":"projectq-stack-latest"},"Privileges":{"CredentialSpec":null,"SELinuxContext":null},"Isolation":"default"},"Resources":{},"RestartPolicy":{"Condition":"on-failure","MaxAttempts":0},"Placement":{"Platforms":[{"Architecture":"amd64","OS":"linux"}]},"Networks":[{"Target":"gruw0a4grxj58zjf2dens9ezk","Aliases":["backend"]},{"Target":"jmrezbnml8vk47h0jz4f5nmjz","Aliases":["backend"]}],"ForceUpdate":0,"Runtime":"container"},"Mode":{"Replicated":{"Replicas":2}},"UpdateConfig":{"Parallelism":1,"Delay":10000000000,"FailureAction":"pause","MaxFailureRatio":0,"Order":"stop-first"},"EndpointSpec":{"Mode":"vip"}},"PreviousSpec":{"Name":"projectq-stack-latest_backend","Labels":{"com.docker.stack.image":"docker-registry.private-host.com/projectq-app","com.docker.stack.namespace":"projectq-stack-latest","traefik.backend":"app","traefik.backend.loadbalancer.swarm":"true","traefik.docker.network":"web","traefik.enable":"true","traefik.frontend.passHostHeader":"true","traefik.frontend.rule":"Host:projectq-002.private-host.com","traefik.port":"8000","traefik.protocol":"http"},"TaskTemplate":{"ContainerSpec":{"Image":"docker-registry.private-host.com/projectq-app:latest@sha256:c72e6f0209f1d7feecb526e9a26fc276577538c4b840278bd9734d8fcb5cd180","Labels":{"com.docker.stack.namespace":"projectq-stack-latest"},"Privileges":{"CredentialSpec":null,"SELinuxContext":null},"Isolation":"default"},"Resources":{},"RestartPolicy":{"Condition":"on-failure","MaxAttempts":0},"Placement":{"Platforms":[{"Architecture":"amd64","OS":"linux"}]},"Networks":[{"Target":"gruw0a4grxj58zjf2dens9ezk","Aliases":["backend"]},{"Target":"jmrezbnml8vk47h0jz4f5nmjz","Aliases":["backend"]}],"ForceUpdate":0,"Runtime":"container"},"Mode":{"Replicated":{"Replicas":2}},"UpdateConfig":{"Parallelism":1,"Delay":10000000000,"FailureAction":"pause","MaxFailureRatio":0,"Order":"stop-first"},"EndpointSpec":{"Mode":"vip"}},"Endpoint":{"Spec":{"Mode":"vip"},"VirtualIPs":[{"NetworkID":"gruw0a4grxj58zjf2dens9ezk","Addr":"10.0.2.181/24"},{"NetworkID":"jmrezbnml8vk47h0jz4f5nmjz","Addr":"10.0.1.202/24"}]},"UpdateStatus":{"State":"completed","StartedAt":"2018-09-16T22:12:23.2894165Z","CompletedAt":"2018-09-16T22:13:00.88211065Z","Message":"update completed"}}`
+)
 
 type FakeService struct {
 	Programm []DResp
@@ -46,7 +49,8 @@ func TestSwarmErrorsWithSockerServerFakeTLS(t *testing.T) {
 			Status:  http.StatusBadRequest,
 			Payload: payloadDockerService,
 			Result: CR{
-				"error": "can't connect to docker host: Could not load X509 key pair: open /tmp/cert.pem: no such file or directory",
+				"error":    "can't connect to docker host: Could not load X509 key pair: open /tmp/cert.pem: no such file or directory",
+				"services": []CR{failedDeployResult("can't connect to docker host: Could not load X509 key pair: open /tmp/cert.pem: no such file or directory")},
 			},
 		},
 	}
@@ -75,7 +79,7 @@ func TestSwarmErrorsWithSockerServerFakeCodes(t *testing.T) {
 			DResp: []DResp{
 				{
 					statusCode:   http.StatusOK,
-					responseBody: []byte(`{"ID":"knmtuvl25atbbpmsra8yl6daz","Version":{"Index":92917},"CreatedAt":"2018-09-15T21:53:48.33970499Z","UpdatedAt":"2018-09-22T16:51:58.819201217Z","Spec":{"Name":"projectq-stack-latest_backend","Labels":{"com.docker.stack.image":"docker-registry.private-host.com/projectq-app","com.docker.stack.namespace":"projectq-stack-latest","traefik.backend":"app","traefik.backend.loadbalancer.swarm":"true","traefik.docker.network":"web","traefik.enable":"true","traefik.frontend.passHostHeader":"true","traefik.frontend.rule":"Host:projectq-002.private-host.com","traefik.port":"8000","traefik.protocol":"http"},"TaskTemplate":{"ContainerSpec":{"Image":"docker-registry.private-host.com/projectq-app:latest","Labels":{"com.docker.stack.namespace":"projectq-stack-latest"},"Privileges":{"CredentialSpec":null,"SELinuxContext":null},"Isolation":"default"},"Resources":{},"RestartPolicy":{"Condition":"on-failure","MaxAttempts":0},"Placement":{"Platforms":[{"Architecture":"amd64","OS":"linux"}]},"Networks":[{"Target":"gruw0a4grxj58zjf2dens9ezk","Aliases":["backend"]},{"Target":"jmrezbnml8vk47h0jz4f5nmjz","Aliases":["backend"]}],"ForceUpdate":0,"Runtime":"container"},"Mode":{"Replicated":{"Replicas":2}},"UpdateConfig":{"Parallelism":1,"Delay":10000000000,"FailureAction":"pause","MaxFailureRatio":0,"Order":"stop-first"},"EndpointSpec":{"Mode":"vip"}},"PreviousSpec":{"Name":"projectq-stack-latest_backend","Labels":{"com.docker.stack.image":"docker-registry.private-host.com/projectq-app","com.docker.stack.namespace":"projectq-stack-latest","traefik.backend":"app","traefik.backend.loadbalancer.swarm":"true","traefik.docker.network":"web","traefik.enable":"true","traefik.frontend.passHostHeader":"true","traefik.frontend.rule":"Host:projectq-002.private-host.com","traefik.port":"8000","traefik.protocol":"http"},"TaskTemplate":{"ContainerSpec":{"Image":"docker-registry.private-host.com/projectq-app:latest@sha256:c72e6f0209f1d7feecb526e9a26fc276577538c4b840278bd9734d8fcb5cd180","Labels":{"com.docker.stack.namespace":"projectq-stack-latest"},"Privileges":{"CredentialSpec":null,"SELinuxContext":null},"Isolation":"default"},"Resources":{},"RestartPolicy":{"Condition":"on-failure","MaxAttempts":0},"Placement":{"Platforms":[{"Architecture":"amd64","OS":"linux"}]},"Networks":[{"Target":"gruw0a4grxj58zjf2dens9ezk","Aliases":["backend"]},{"Target":"jmrezbnml8vk47h0jz4f5nmjz","Aliases":["backend"]}],"ForceUpdate":0,"Runtime":"container"},"Mode":{"Replicated":{"Replicas":2}},"UpdateConfig":{"Parallelism":1,"Delay":10000000000,"FailureAction":"pause","MaxFailureRatio":0,"Order":"stop-first"},"EndpointSpec":{"Mode":"vip"}},"Endpoint":{"Spec":{"Mode":"vip"},"VirtualIPs":[{"NetworkID":"gruw0a4grxj58zjf2dens9ezk","Addr":"10.0.2.181/24"},{"NetworkID":"jmrezbnml8vk47h0jz4f5nmjz","Addr":"10.0.1.202/24"}]},"UpdateStatus":{"State":"completed","StartedAt":"2018-09-16T22:12:23.2894165Z","CompletedAt":"2018-09-16T22:13:00.88211065Z","Message":"update completed"}}`),
+					responseBody: []byte(fakeServiceInspectBody),
 				},
 				{
 					statusCode:   http.StatusBadGateway,
@@ -83,7 +87,8 @@ func TestSwarmErrorsWithSockerServerFakeCodes(t *testing.T) {
 				},
 			},
 			Result: CR{
-				"error": "updating a service: knmtuvl25atbbpmsra8yl6daz, Error response from daemon: {}",
+				"error":    "updating a service: knmtuvl25atbbpmsra8yl6daz, Error response from daemon: {}",
+				"services": []CR{failedDeployResult("updating a service: knmtuvl25atbbpmsra8yl6daz, Error response from daemon: {}")},
 			},
 		},
 		{ // case 1
@@ -96,7 +101,7 @@ func TestSwarmErrorsWithSockerServerFakeCodes(t *testing.T) {
 			DResp: []DResp{
 				{
 					statusCode:   http.StatusOK,
-					responseBody: []byte(`{"ID":"knmtuvl25atbbpmsra8yl6daz","Version":{"Index":92917},"CreatedAt":"2018-09-15T21:53:48.33970499Z","UpdatedAt":"2018-09-22T16:51:58.819201217Z","Spec":{"Name":"projectq-stack-latest_backend","Labels":{"com.docker.stack.image":"docker-registry.private-host.com/projectq-app","com.docker.stack.namespace":"projectq-stack-latest","traefik.backend":"app","traefik.backend.loadbalancer.swarm":"true","traefik.docker.network":"web","traefik.enable":"true","traefik.frontend.passHostHeader":"true","traefik.frontend.rule":"Host:projectq-002.private-host.com","traefik.port":"8000","traefik.protocol":"http"},"TaskTemplate":{"ContainerSpec":{"Image":"docker-registry.private-host.com/projectq-app:latest","Labels":{"com.docker.stack.namespace":"projectq-stack-latest"},"Privileges":{"CredentialSpec":null,"SELinuxContext":null},"Isolation":"default"},"Resources":{},"RestartPolicy":{"Condition":"on-failure","MaxAttempts":0},"Placement":{"Platforms":[{"Architecture":"amd64","OS":"linux"}]},"Networks":[{"Target":"gruw0a4grxj58zjf2dens9ezk","Aliases":["backend"]},{"Target":"jmrezbnml8vk47h0jz4f5nmjz","Aliases":["backend"]}],"ForceUpdate":0,"Runtime":"container"},"Mode":{"Replicated":{"Replicas":2}},"UpdateConfig":{"Parallelism":1,"Delay":10000000000,"FailureAction":"pause","MaxFailureRatio":0,"Order":"stop-first"},"EndpointSpec":{"Mode":"vip"}},"PreviousSpec":{"Name":"projectq-stack-latest_backend","Labels":{"com.docker.stack.image":"docker-registry.private-host.com/projectq-app","com.docker.stack.namespace":"projectq-stack-latest","traefik.backend":"app","traefik.backend.loadbalancer.swarm":"true","traefik.docker.network":"web","traefik.enable":"true","traefik.frontend.passHostHeader":"true","traefik.frontend.rule":"Host:projectq-002.private-host.com","traefik.port":"8000","traefik.protocol":"http"},"TaskTemplate":{"ContainerSpec":{"Image":"docker-registry.private-host.com/projectq-app:latest@sha256:c72e6f0209f1d7feecb526e9a26fc276577538c4b840278bd9734d8fcb5cd180","Labels":{"com.docker.stack.namespace":"projectq-stack-latest"},"Privileges":{"CredentialSpec":null,"SELinuxContext":null},"Isolation":"default"},"Resources":{},"RestartPolicy":{"Condition":"on-failure","MaxAttempts":0},"Placement":{"Platforms":[{"Architecture":"amd64","OS":"linux"}]},"Networks":[{"Target":"gruw0a4grxj58zjf2dens9ezk","Aliases":["backend"]},{"Target":"jmrezbnml8vk47h0jz4f5nmjz","Aliases":["backend"]}],"ForceUpdate":0,"Runtime":"container"},"Mode":{"Replicated":{"Replicas":2}},"UpdateConfig":{"Parallelism":1,"Delay":10000000000,"FailureAction":"pause","MaxFailureRatio":0,"Order":"stop-first"},"EndpointSpec":{"Mode":"vip"}},"Endpoint":{"Spec":{"Mode":"vip"},"VirtualIPs":[{"NetworkID":"gruw0a4grxj58zjf2dens9ezk","Addr":"10.0.2.181/24"},{"NetworkID":"jmrezbnml8vk47h0jz4f5nmjz","Addr":"10.0.1.202/24"}]},"UpdateStatus":{"State":"completed","StartedAt":"2018-09-16T22:12:23.2894165Z","CompletedAt":"2018-09-16T22:13:00.88211065Z","Message":"update completed"}}`),
+					responseBody: []byte(fakeServiceInspectBody),
 				},
 				{
 					statusCode:   http.StatusOK,
@@ -105,6 +110,11 @@ func TestSwarmErrorsWithSockerServerFakeCodes(t *testing.T) {
 			},
 			Result: CR{
 				"status": "OK",
+				"services": []CR{{
+					"service": "projectq-stack-latest_backend",
+					"image":   "docker-registry.private-host.com/projectq-app:latest",
+					"status":  "OK",
+				}},
 			},
 		},
 	}
@@ -114,6 +124,49 @@ func TestSwarmErrorsWithSockerServerFakeCodes(t *testing.T) {
 	//os.Remove(dockerSimpleSocket)
 }
 
+func TestSwarmDeployToManyServices(t *testing.T) {
+	config := testConfig
+	config.Services = map[string]serviceList{
+		"docker-registry.private-host.com/projectq-app:latest": {"projectq-stack-latest_backend", "projectq-stack-latest_worker"},
+	}
+	ts := httptest.NewServer(&SwarmServiceHandler{config, testUpdateOpts})
+
+	workerErr := "can't connect to service projectq-stack-latest_worker: Error: No such service: projectq-stack-latest_worker"
+	cases := []Case{
+		{ // case 0: the 2nd service fails, the 1st one is still updated
+			Path:    APIEndpointWebHookRegistry,
+			Method:  http.MethodPost,
+			Query:   fmt.Sprintf("%s=%s", APIWebHookKeyName, config.APISecretKey),
+			Status:  http.StatusBadRequest,
+			Payload: payloadDockerService,
+			DHost:   "unix://" + dockerSimpleSocket,
+			DResp: []DResp{
+				{statusCode: http.StatusOK, responseBody: []byte(fakeServiceInspectBody)},
+				{statusCode: http.StatusOK, responseBody: []byte(`{}`)},
+				{statusCode: http.StatusNotFound, responseBody: []byte(`{"message": "service not found"}`)},
+			},
+			Result: CR{
+				"error": workerErr,
+				"services": []CR{
+					{
+						"service": "projectq-stack-latest_backend",
+						"image":   "docker-registry.private-host.com/projectq-app:latest",
+						"status":  "OK",
+					},
+					{
+						"service": "projectq-stack-latest_worker",
+						"image":   "docker-registry.private-host.com/projectq-app:latest",
+						"status":  "FAILED",
+						"error":   workerErr,
+					},
+				},
+			},
+		},
+	}
+
+	runTests(t, ts, cases, config)
+}
+
 type errReader int
 
 const ioutilReaderTestErrorMsg = "ioreader test error"
@@ -124,7 +177,7 @@ func (errReader) Read(p []byte) (n int, err error) {
 
 func TestSwarmErrorsWithIoutilReadAll(t *testing.T) {
 	h := &SwarmServiceHandler{testConfig, testUpdateOpts}
-	_, err := h.getHookParamsFromPayload(errReader(0), APIEndpointWebHookRegistry)
+	_, err := h.getHookParamsFromPayload(errReader(0), APIEndpointWebHookRegistry, nil)
 	if err.Error() != ioutilReaderTestErrorMsg {
 		t.Errorf("expected error: %s,\ngot: %s", ioutilReaderTestErrorMsg, err.Error())
 
@@ -133,13 +186,16 @@ func TestSwarmErrorsWithIoutilReadAll(t *testing.T) {
 
 func TestSwarmErrorsWithEmptyHookParamsFromPayload(t *testing.T) {
 	h := &SwarmServiceHandler{testConfig, testUpdateOpts}
-	cases := []HookParamsFromPayload{
+	cases := []struct {
+		registryImage string
+		serviceName   string
+	}{
 		{"", ""},
 		{"test", ""},
 		{"", "test"},
 	}
 	for _, v := range cases {
-		err := h.updateService(HookParamsFromPayload{v.registryImage, v.serviceName})
+		_, _, err := h.updateService(HookParamsFromPayload{registryImage: v.registryImage}, v.serviceName)
 		expectedError := fmt.Sprintf("nothing to do, exit. SN: %s IMG: %s", v.serviceName, v.registryImage)
 		if err.Error() != expectedError {
 			t.Errorf("expected error: %s,\ngot: %s", expectedError, err.Error())
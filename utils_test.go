@@ -11,7 +11,7 @@ func TestLogz(t *testing.T) {
 	Logz("Test %s\n", "OK")
 	LogRespWriter(0, err.Err)
 	h := SwarmServiceHandler{}
-	_, err.Err = h.getHookParamsFromPayload(nil, "/fake/")
+	_, err.Err = h.getHookParamsFromPayload(nil, "/fake/", nil)
 	if err.Err == nil {
 		t.Errorf("bad error")
 	}